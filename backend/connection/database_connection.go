@@ -20,14 +20,19 @@ type DBConnector interface{
 	Connect(ctx context.Context, dsn string) (DBConnection, error)
 }
 
-type DBConnection interface {
-	BeginConn(ctx context.Context) (pgx.Tx, error)
-	CloseConn(ctx context.Context) error
+// Querier is the set of query methods shared by connections and transactions (pgx.Tx satisfies it)
+type Querier interface {
 	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
 	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
 	Exec (ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
 }
 
+type DBConnection interface {
+	Querier
+	BeginConn(ctx context.Context) (pgx.Tx, error)
+	CloseConn(ctx context.Context) error
+}
+
 type EnvConfigLoader struct{}
 
 func (e *EnvConfigLoader) Load() error {
@@ -85,7 +90,22 @@ func BuildDSN(user, password, url, sslMode string) string {
 	return fmt.Sprintf("postgresql://%s:%s%s?sslmode=%s", user, password, url, sslMode)
 }
 
+// GetDatabaseConnection returns a pooled connection once InitPool was called,
+// otherwise it dials a dedicated connection. Callers release it with CloseConn.
 func GetDatabaseConnection() (DBConnection, error) {
+	if poolConnector != nil {
+		conn, err := poolConnector.Connect(context.Background(), "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire pooled connection: %w", err)
+		}
+		return conn, nil
+	}
+	return GetDedicatedConnection()
+}
+
+// GetDedicatedConnection always dials a connection outside the pool, for
+// session state such as advisory locks that must not take a pool slot
+func GetDedicatedConnection() (DBConnection, error) {
 	err := configLoader.Load()
 	if err != nil {
 		return nil, fmt.Errorf("error loading .env file: %w",err)
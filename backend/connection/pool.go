@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PoolConfig holds the tunables of the connection pool. Zero values keep the pgxpool defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnIdleTime   time.Duration
+	MaxConnLifetime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+// PoolStats is a snapshot of the pool usage
+type PoolStats struct {
+	MaxConns             int32  `json:"max_conns"`
+	TotalConns           int32  `json:"total_conns"`
+	IdleConns            int32  `json:"idle_conns"`
+	AcquiredConns        int32  `json:"acquired_conns"`
+	ConstructingConns    int32  `json:"constructing_conns"`
+	AcquireCount         int64  `json:"acquire_count"`
+	EmptyAcquireCount    int64  `json:"empty_acquire_count"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	AcquireDuration      string `json:"acquire_duration"`
+}
+
+type PgxPoolConnector struct {
+	pool *pgxpool.Pool
+}
+
+// Connect acquires a connection from the pool, the DSN was already applied when the pool was created
+func (p *PgxPoolConnector) Connect(ctx context.Context, dsn string) (DBConnection, error) {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &PgxPoolConnection{conn: conn}, nil
+}
+
+type PgxPoolConnection struct {
+	conn *pgxpool.Conn
+}
+
+func (p *PgxPoolConnection) BeginConn(ctx context.Context) (pgx.Tx, error) {
+	return p.conn.Begin(ctx)
+}
+
+// CloseConn releases the connection back to the pool
+func (p *PgxPoolConnection) CloseConn(ctx context.Context) error {
+	p.conn.Release()
+	return nil
+}
+
+func (p *PgxPoolConnection) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return p.conn.QueryRow(ctx, sql, args...)
+}
+
+func (p *PgxPoolConnection) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return p.conn.Query(ctx, sql, args...)
+}
+
+func (p *PgxPoolConnection) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return p.conn.Exec(ctx, sql, args...)
+}
+
+// poolConnector is set by InitPool, once set GetDatabaseConnection hands out pooled connections
+var poolConnector *PgxPoolConnector
+
+// LoadPoolConfig reads the pool settings from DB_MAX_CONNS, DB_MIN_CONNS,
+// DB_MAX_CONN_IDLE_TIME, DB_MAX_CONN_LIFETIME and DB_HEALTH_CHECK_PERIOD.
+func LoadPoolConfig() (PoolConfig, error) {
+	var cfg PoolConfig
+
+	maxConns, err := parseInt32Env("DB_MAX_CONNS")
+	if err != nil {
+		return cfg, err
+	}
+	minConns, err := parseInt32Env("DB_MIN_CONNS")
+	if err != nil {
+		return cfg, err
+	}
+	if maxConns > 0 && minConns > maxConns {
+		return cfg, fmt.Errorf("DB_MIN_CONNS (%d) cannot be greater than DB_MAX_CONNS (%d)", minConns, maxConns)
+	}
+	cfg.MaxConns = maxConns
+	cfg.MinConns = minConns
+
+	durations := []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"DB_MAX_CONN_IDLE_TIME", &cfg.MaxConnIdleTime},
+		{"DB_MAX_CONN_LIFETIME", &cfg.MaxConnLifetime},
+		{"DB_HEALTH_CHECK_PERIOD", &cfg.HealthCheckPeriod},
+	}
+	for _, d := range durations {
+		value := configLoader.GetEnv(d.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q: expected a positive duration like 30s or 5m", d.key, value)
+		}
+		*d.target = parsed
+	}
+
+	return cfg, nil
+}
+
+func parseInt32Env(key string) (int32, error) {
+	value := configLoader.GetEnv(key)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a non-negative integer", key, value)
+	}
+	return int32(parsed), nil
+}
+
+// InitPool creates the shared connection pool. It is meant to be called once at startup,
+// afterwards GetDatabaseConnection acquires connections from the pool instead of dialing.
+func InitPool(ctx context.Context) error {
+	if poolConnector != nil {
+		return nil
+	}
+
+	err := configLoader.Load()
+	if err != nil {
+		return fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	poolCfg, err := LoadPoolConfig()
+	if err != nil {
+		return err
+	}
+
+	dsn := BuildDSN(
+		configLoader.GetEnv("DATABASE_USER"),
+		configLoader.GetEnv("DATABASE_PASSWORD"),
+		configLoader.GetEnv("DATABASE_URL"),
+		configLoader.GetEnv("SSL_LOCAL"),
+	)
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return fmt.Errorf("invalid database configuration: %w", err)
+	}
+	if poolCfg.MaxConns > 0 {
+		cfg.MaxConns = poolCfg.MaxConns
+	}
+	if poolCfg.MinConns > 0 {
+		cfg.MinConns = poolCfg.MinConns
+	}
+	if poolCfg.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = poolCfg.MaxConnIdleTime
+	}
+	if poolCfg.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = poolCfg.MaxConnLifetime
+	}
+	if poolCfg.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = poolCfg.HealthCheckPeriod
+	}
+
+	pool, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	poolConnector = &PgxPoolConnector{pool: pool}
+	return nil
+}
+
+// ClosePool closes every pooled connection
+func ClosePool() {
+	if poolConnector == nil {
+		return
+	}
+	poolConnector.pool.Close()
+	poolConnector = nil
+}
+
+// Stats returns the current pool usage, or nil when no pool was initialized
+func Stats() *PoolStats {
+	if poolConnector == nil {
+		return nil
+	}
+	s := poolConnector.pool.Stat()
+	return &PoolStats{
+		MaxConns:             s.MaxConns(),
+		TotalConns:           s.TotalConns(),
+		IdleConns:            s.IdleConns(),
+		AcquiredConns:        s.AcquiredConns(),
+		ConstructingConns:    s.ConstructingConns(),
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireDuration:      s.AcquireDuration().String(),
+	}
+}
@@ -0,0 +1,104 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockEnv(envVars map[string]string) *MockConfigLoader {
+	return &MockConfigLoader{
+		GetEnvFunc: func(key string) string {
+			return envVars[key]
+		},
+	}
+}
+
+func TestLoadPoolConfig_Defaults(t *testing.T) {
+	teardown := setupTest()
+	defer teardown()
+
+	configLoader = mockEnv(map[string]string{})
+
+	cfg, err := LoadPoolConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, PoolConfig{}, cfg)
+}
+
+func TestLoadPoolConfig_AllValues(t *testing.T) {
+	teardown := setupTest()
+	defer teardown()
+
+	configLoader = mockEnv(map[string]string{
+		"DB_MAX_CONNS":           "20",
+		"DB_MIN_CONNS":           "2",
+		"DB_MAX_CONN_IDLE_TIME":  "5m",
+		"DB_MAX_CONN_LIFETIME":   "1h",
+		"DB_HEALTH_CHECK_PERIOD": "30s",
+	})
+
+	cfg, err := LoadPoolConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, PoolConfig{
+		MaxConns:          20,
+		MinConns:          2,
+		MaxConnIdleTime:   5 * time.Minute,
+		MaxConnLifetime:   time.Hour,
+		HealthCheckPeriod: 30 * time.Second,
+	}, cfg)
+}
+
+func TestLoadPoolConfig_InvalidValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "Max conns not a number",
+			env:      map[string]string{"DB_MAX_CONNS": "many"},
+			expected: "invalid DB_MAX_CONNS",
+		},
+		{
+			name:     "Negative min conns",
+			env:      map[string]string{"DB_MIN_CONNS": "-1"},
+			expected: "invalid DB_MIN_CONNS",
+		},
+		{
+			name:     "Min conns above max conns",
+			env:      map[string]string{"DB_MAX_CONNS": "2", "DB_MIN_CONNS": "5"},
+			expected: "cannot be greater than DB_MAX_CONNS",
+		},
+		{
+			name:     "Idle time without unit",
+			env:      map[string]string{"DB_MAX_CONN_IDLE_TIME": "300"},
+			expected: "invalid DB_MAX_CONN_IDLE_TIME",
+		},
+		{
+			name:     "Zero health check period",
+			env:      map[string]string{"DB_HEALTH_CHECK_PERIOD": "0s"},
+			expected: "invalid DB_HEALTH_CHECK_PERIOD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teardown := setupTest()
+			defer teardown()
+
+			configLoader = mockEnv(tt.env)
+
+			_, err := LoadPoolConfig()
+
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestStats_WithoutPool(t *testing.T) {
+	assert.Nil(t, Stats())
+}
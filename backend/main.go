@@ -1,42 +1,466 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"stock-investment-backend/connection"
+	"stock-investment-backend/migrations"
 	"stock-investment-backend/server"
 	"stock-investment-backend/service"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
 	var (
-		apiMode   = flag.Bool("api", false, "Run in API server mode")
-		fetchMode = flag.Bool("fetch", false, "Fetch data from external API")
-		port      = flag.String("port", "8080", "Port for API server")
+		apiMode     = flag.Bool("api", false, "Run in API server mode")
+		fetchMode   = flag.Bool("fetch", false, "Fetch data from external API")
+		sourceName  = flag.String("source", service.DefaultSourceName, "Registered recommendation source to fetch from (with -fetch)")
+		incremental = flag.Bool("incremental", false, "Resume from the last sync checkpoint and fetch only new data (with -fetch)")
+		port        = flag.String("port", "8080", "Port for API server")
+		saveMode    = flag.String("save-mode", string(service.SaveBatch), "How -fetch, -replay and -import save data: atomic (all-or-nothing) or batch (savepoint per batch)")
+		batchSize   = flag.Int("batch-size", service.DefaultBatchSize, "Number of recommendations per batch when saving")
+		importPath  = flag.String("import", "", "Import recommendations from a CSV or NDJSON file")
+		importFmt   = flag.String("import-format", "", "Format of the -import file: csv or ndjson (default: from the extension)")
+		importMap   = flag.String("import-map", "", "Column mapping for -import, e.g. ticker=Symbol,time=Date")
+		importSrc   = flag.String("import-source", service.ImportSourceName, "Source recorded for imported recommendations")
+		exportPath  = flag.String("export", "", "Export recommendations to a CSV or NDJSON file")
+		exportFmt   = flag.String("export-format", "", "Format of the -export file: csv or ndjson (default: from the extension)")
+		exportTick  = flag.String("export-ticker", "", "Only export recommendations for this ticker")
+		exportBrk   = flag.String("export-brokerage", "", "Only export recommendations from this brokerage id")
+		exportSrc   = flag.String("export-source", "", "Only export recommendations from this source")
+		compare     = flag.String("compare-profiles", "", "Compare the rankings of two scoring profiles, e.g. default,momentum")
+		compareTop  = flag.Int("compare-limit", 20, "Number of companies shown by -compare-profiles")
+		renormalize = flag.Bool("renormalize-ratings", false, "Recompute the normalized rating scores of stored recommendations")
+		reclassify  = flag.Bool("reclassify-actions", false, "Recompute the event types of stored recommendations")
+		replayRun   = flag.String("replay", "", "Convert and save again the pages archived by the -fetch run with this id")
+		reprocess   = flag.Bool("reprocess-failed", false, "Retry the recommendations rejected by earlier runs")
+		reprocSrc   = flag.String("reprocess-source", "", "Only retry the rejected recommendations of this source")
+		backfill    = flag.Bool("backfill-fingerprints", false, "Fingerprint legacy recommendations and remove duplicates")
+		migrate     = flag.String("migrate", "", "Run schema migrations: up, down, status or to N")
+		autoMigrate = flag.Bool("migrate-on-start", false, "Apply pending migrations before starting")
+		storeKind   = flag.String("store", "postgres", "Storage backend for the API server: postgres or memory")
+		driftMode   = flag.String("schema-drift", envOr("SCHEMA_DRIFT", string(service.DriftWarn)), "How -fetch, -daemon and -replay react to payloads that do not match the expected schema: warn, fail or off")
+		daemon      = flag.Bool("daemon", false, "Run the -fetch sync periodically until interrupted (with -api, next to the API server)")
+		schedule    = flag.String("schedule", envOr("SYNC_SCHEDULE", "@hourly"), "When -daemon syncs: a 5 field cron expression, @hourly, @daily, @weekly or @every <duration>")
 	)
 	flag.Parse()
 
 	fmt.Println("Starting Stock Investment Backend...")
 
+	profiles, err := service.LoadScoringProfilesFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *storeKind {
+	case "postgres":
+	case "memory":
+		// The in-memory store needs no database at all
+		if !*apiMode {
+			log.Fatal("-store=memory is only supported together with -api")
+		}
+		fmt.Println("⚠️  Using in-memory store, data is not persisted")
+		srv := server.NewServer(service.NewMemoryStore(), profiles)
+		srv.Start(*port)
+		return
+	default:
+		log.Fatalf("unknown store %q (expected postgres or memory)", *storeKind)
+	}
+
+	// Create the shared connection pool
+	if err := connection.InitPool(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	defer connection.ClosePool()
+
+	if *migrate != "" {
+		fmt.Println("Running migrations...")
+		if err := runMigrate(*migrate, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *autoMigrate {
+		fmt.Println("Applying pending migrations...")
+		if err := runMigrate("up", nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Test database connection
 	fmt.Println("Testing database connection...")
 	if err := connection.TestDatabaseConnection(); err != nil {
 		log.Fatal(err)
 	}
 
-	if *fetchMode {
+	if *backfill {
+		fmt.Println("Backfilling recommendation fingerprints...")
+		updated, deleted, err := service.BackfillFingerprints()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("✅ %d recommendations fingerprinted, %d duplicates removed\n", updated, deleted)
+	} else if *importPath != "" {
+		fmt.Printf("Importing %s...\n", *importPath)
+		mode, err := service.ParseSaveMode(*saveMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mapping, err := service.ParseColumnMapping(*importMap)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var format service.FileFormat
+		if *importFmt != "" {
+			format, err = service.ParseFileFormat(*importFmt)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		result, err := service.ImportFile(service.ImportOptions{
+			Path:    *importPath,
+			Format:  format,
+			Mapping: mapping,
+			Source:  *importSrc,
+			Save:    service.SaveOptions{Mode: mode, BatchSize: *batchSize},
+		})
+		fmt.Printf("Import %s\n", result)
+		if err != nil {
+			log.Printf("❌ Import failed: %v", err)
+			connection.ClosePool()
+			os.Exit(1)
+		}
+		// Like -fetch, exit with 2 when some lines were rejected
+		if len(result.Errors) > 0 {
+			connection.ClosePool()
+			os.Exit(2)
+		}
+	} else if *exportPath != "" {
+		fmt.Printf("Exporting to %s...\n", *exportPath)
+		if err := runExport(*exportPath, *exportFmt, service.RecommendationFilter{
+			Ticker:      *exportTick,
+			BrokerageID: *exportBrk,
+			Source:      *exportSrc,
+		}); err != nil {
+			log.Fatal(err)
+		}
+	} else if *renormalize {
+		fmt.Println("Renormalizing ratings...")
+		updated, err := service.NewPostgresStore().RenormalizeRatings(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("✅ %d recommendations renormalized\n", updated)
+	} else if *reclassify {
+		fmt.Println("Reclassifying actions...")
+		updated, err := service.ReclassifyActions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("✅ %d recommendations reclassified\n", updated)
+	} else if *replayRun != "" {
+		fmt.Printf("Replaying ingest run %s...\n", *replayRun)
+		mode, err := service.ParseSaveMode(*saveMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		drift, err := service.ParseDriftMode(*driftMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result := service.Replay(*replayRun, service.SaveOptions{Mode: mode, BatchSize: *batchSize}, drift)
+		fmt.Printf("Replay %s\n", result)
+		switch result.Status {
+		case service.SyncSkipped:
+			log.Printf("❌ Another sync is running, try again once it is done")
+			connection.ClosePool()
+			os.Exit(1)
+		case service.SyncFailed:
+			connection.ClosePool()
+			os.Exit(1)
+		case service.SyncPartial:
+			connection.ClosePool()
+			os.Exit(2)
+		}
+	} else if *reprocess {
+		fmt.Println("Reprocessing failed recommendations...")
+		mode, err := service.ParseSaveMode(*saveMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result, err := service.ReprocessFailed(service.ReprocessOptions{
+			Source: *reprocSrc,
+			Save:   service.SaveOptions{Mode: mode, BatchSize: *batchSize},
+		})
+		fmt.Printf("Reprocess %s\n", result)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *compare != "" {
+		if err := runCompareProfiles(profiles, *compare, *compareTop); err != nil {
+			log.Fatal(err)
+		}
+	} else if *daemon {
+		mode, err := service.ParseSaveMode(*saveMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		drift, err := service.ParseDriftMode(*driftMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		retry, err := service.LoadRetryPolicy()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts := service.FetchOptions{
+			Source:      *sourceName,
+			Incremental: *incremental,
+			Save:        service.SaveOptions{Mode: mode, BatchSize: *batchSize},
+			Retry:       retry,
+			Drift:       drift,
+		}
+		if err := opts.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		sched, err := service.NewScheduler(*schedule, func() service.SyncResult {
+			return service.ApiGet(opts)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if *apiMode {
+			srv := server.NewServer(service.NewPostgresStore(), profiles)
+			srv.SetScheduler(sched)
+			go srv.Start(*port)
+		}
+		fmt.Printf("Scheduling syncs from %s (%s)...\n", *sourceName, *schedule)
+		sched.Run(ctx)
+		fmt.Println("Scheduler stopped")
+	} else if *fetchMode {
 		// Fetch API data and save to database
 		fmt.Println("Fetching API data...")
-		service.ApiGet()
+		mode, err := service.ParseSaveMode(*saveMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		drift, err := service.ParseDriftMode(*driftMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		retry, err := service.LoadRetryPolicy()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts := service.FetchOptions{
+			Source:      *sourceName,
+			Incremental: *incremental,
+			Save:        service.SaveOptions{Mode: mode, BatchSize: *batchSize},
+			Retry:       retry,
+			Drift:       drift,
+		}
+		if err := opts.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		result := service.ApiGet(opts)
+		fmt.Printf("Sync %s\n", result)
+		// Non-zero exit codes let schedulers tell partial (2) and failed (1) syncs apart
+		switch result.Status {
+		case service.SyncSkipped:
+			log.Printf("❌ Another sync is running, try again once it is done")
+			connection.ClosePool()
+			os.Exit(1)
+		case service.SyncFailed:
+			connection.ClosePool()
+			os.Exit(1)
+		case service.SyncPartial:
+			connection.ClosePool()
+			os.Exit(2)
+		}
 	} else if *apiMode {
 		// Start API server
-		srv := server.NewServer()
+		srv := server.NewServer(service.NewPostgresStore(), profiles)
 		srv.Start(*port)
 	} else {
 		fmt.Println("Usage:")
 		fmt.Println("  -fetch    Fetch data from external API")
-		fmt.Println("  -api      Start API server")
+		fmt.Println("  -source   Recommendation source to fetch from (default: api)")
+		fmt.Println("  -incremental  Resume from the last checkpoint and fetch only new data (with -fetch)")
+		fmt.Println("  -save-mode    atomic (all-or-nothing) or batch (savepoint per batch, default)")
+		fmt.Println("  -batch-size   Recommendations per batch when saving (default: 1000)")
+		fmt.Println("  -import <file>  Import recommendations from a CSV or NDJSON file")
+		fmt.Println("  -import-format  csv or ndjson (default: detected from the extension)")
+		fmt.Println("  -import-map     Column mapping, e.g. ticker=Symbol,time=Date")
+		fmt.Println("  -import-source  Source recorded for imported rows (default: import)")
+		fmt.Println("  -export <file>  Export recommendations to a CSV or NDJSON file")
+		fmt.Println("  -export-format  csv or ndjson (default: detected from the extension)")
+		fmt.Println("  -export-ticker, -export-brokerage, -export-source  Filter the export")
+		fmt.Println("  -compare-profiles a,b  Compare the rankings of two scoring profiles")
+		fmt.Println("  -compare-limit  Companies shown by -compare-profiles (default: 20)")
+		fmt.Println("  -renormalize-ratings  Recompute rating scores after editing rating_mapping")
+		fmt.Println("  -reclassify-actions  Recompute event types, e.g. after upgrading from an older schema")
+		fmt.Println("  -replay <run-id>  Convert and save the archived pages of a -fetch run again")
+		fmt.Println("  -reprocess-failed  Retry rejected recommendations kept in ingest_dead_letter")
+		fmt.Println("  -reprocess-source  Only retry the ones of this source (default: all)")
+		fmt.Println("  -backfill-fingerprints  Fingerprint legacy rows and remove duplicates")
+		fmt.Println("  -migrate  Run schema migrations: up, down, status or to N")
+		fmt.Println("  -migrate-on-start  Apply pending migrations before starting")
+		fmt.Println("  -schema-drift  warn (default), fail or off when payloads do not match the expected schema")
+		fmt.Println("  -daemon   Sync periodically until interrupted, takes the -fetch flags")
+		fmt.Println("  -schedule When -daemon syncs, cron or @every <duration> (default: $SYNC_SCHEDULE or @hourly)")
+		fmt.Println("  -api      Start API server (with -daemon, next to the scheduler)")
 		fmt.Println("  -port     Port for API server (default: 8080)")
+		fmt.Println("  -store    Storage backend for the API: postgres (default) or memory")
+	}
+}
+
+// envOr returns the environment variable key, or fallback when it is not set
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// runExport writes the recommendations matching filter to path
+func runExport(path, formatName string, filter service.RecommendationFilter) error {
+	var format service.FileFormat
+	var err error
+	if formatName != "" {
+		format, err = service.ParseFileFormat(formatName)
+	} else {
+		format, err = service.DetectFileFormat(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating export file: %w", err)
+	}
+
+	count, err := service.ExportRecommendations(context.Background(), service.NewPostgresStore(), filter, format, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error closing export file: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Exported %d recommendations\n", count)
+	return nil
+}
+
+// runCompareProfiles prints the rankings of two scoring profiles side by side
+func runCompareProfiles(profiles service.ScoringProfiles, names string, limit int) error {
+	parts := strings.Split(names, ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: -compare-profiles <profile>,<profile>")
+	}
+	a, err := profiles.Get(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return err
+	}
+	b, err := profiles.Get(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return err
+	}
+
+	store := service.NewPostgresStore()
+	now := time.Now()
+	scoresA, err := service.ComputeScores(context.Background(), store, a, now)
+	if err != nil {
+		return err
+	}
+	scoresB, err := service.ComputeScores(context.Background(), store, b, now)
+	if err != nil {
+		return err
+	}
+
+	comparison := service.CompareRankings(scoresA, scoresB)
+	if limit > 0 && limit < len(comparison) {
+		comparison = comparison[:limit]
+	}
+
+	rank := func(r int) string {
+		if r == 0 {
+			return "-"
+		}
+		return strconv.Itoa(r)
+	}
+	fmt.Printf("%-8s %5s %7s %-12s %5s %7s %-12s %6s\n", "TICKER", "#"+a.Name, "SCORE", "LABEL", "#"+b.Name, "SCORE", "LABEL", "MOVE")
+	for _, c := range comparison {
+		fmt.Printf("%-8s %5s %7.2f %-12s %5s %7.2f %-12s %+6d\n",
+			c.Ticker, rank(c.RankA), c.ScoreA, c.LabelA, rank(c.RankB), c.ScoreB, c.LabelB, c.RankChange())
+	}
+	return nil
+}
+
+// runMigrate executes a -migrate command: up, down, status or to N
+func runMigrate(command string, args []string) error {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return err
+	}
+	defer connection.CloseDatabaseConnection(conn)
+
+	migrator, err := migrations.NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var ran []migrations.Migration
+	switch command {
+	case "up":
+		ran, err = migrator.Up(ctx)
+	case "down":
+		ran, err = migrator.Down(ctx)
+	case "to":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: -migrate to <version>")
+		}
+		version, convErr := strconv.Atoi(args[0])
+		if convErr != nil {
+			return fmt.Errorf("invalid migration version %q", args[0])
+		}
+		ran, err = migrator.To(ctx, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied() {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  %04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down, status or to N)", command)
+	}
+
+	for _, m := range ran {
+		fmt.Printf("  ✅ %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ran) == 0 {
+		fmt.Println("Database schema is already up to date")
 	}
+	return nil
 }
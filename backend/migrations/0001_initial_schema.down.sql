@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analyst_recommendation;
+DROP TABLE IF EXISTS brokerage;
+DROP TABLE IF EXISTS company;
@@ -0,0 +1,31 @@
+-- gen_random_uuid() is built in from PostgreSQL 13, pgcrypto provides it on 12
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS company (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  ticker VARCHAR(10) UNIQUE NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS brokerage (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name VARCHAR(255) UNIQUE NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS analyst_recommendation (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  company_id UUID REFERENCES company(id) ON DELETE CASCADE NOT NULL,
+  brokerage_id UUID REFERENCES brokerage(id) ON DELETE SET NULL,
+  target_from DECIMAL(10,2),
+  target_to DECIMAL(10,2),
+  rating_from VARCHAR(50),
+  rating_to VARCHAR(50),
+  action VARCHAR(100) NOT NULL,
+  time TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
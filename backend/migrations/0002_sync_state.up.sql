@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS sync_state (
+  name VARCHAR(100) PRIMARY KEY,
+  next_page TEXT,
+  last_time TIMESTAMPTZ,
+  run_max_time TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
@@ -0,0 +1 @@
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS fingerprint;
@@ -0,0 +1,3 @@
+-- Natural-key fingerprint used to deduplicate ingested recommendations.
+-- Rows stored before this migration are fingerprinted with -backfill-fingerprints.
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS fingerprint CHAR(64) UNIQUE;
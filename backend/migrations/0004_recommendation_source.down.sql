@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS analyst_recommendation_source_idx;
+ALTER TABLE analyst_recommendation DROP CONSTRAINT IF EXISTS analyst_recommendation_source_fingerprint_key;
+ALTER TABLE analyst_recommendation
+  ADD CONSTRAINT analyst_recommendation_fingerprint_key UNIQUE (fingerprint);
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS source;
@@ -0,0 +1,8 @@
+-- Record which feed delivered each recommendation; deduplication is per source
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS source VARCHAR(50) NOT NULL DEFAULT 'api';
+
+ALTER TABLE analyst_recommendation DROP CONSTRAINT IF EXISTS analyst_recommendation_fingerprint_key;
+ALTER TABLE analyst_recommendation
+  ADD CONSTRAINT analyst_recommendation_source_fingerprint_key UNIQUE (source, fingerprint);
+
+CREATE INDEX IF NOT EXISTS analyst_recommendation_source_idx ON analyst_recommendation (source);
@@ -0,0 +1,4 @@
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS rating_to_score;
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS rating_from_score;
+DROP TABLE IF EXISTS rating_mapping;
+DROP FUNCTION IF EXISTS rating_key(TEXT);
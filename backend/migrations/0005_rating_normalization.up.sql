@@ -0,0 +1,37 @@
+-- Canonical 5-point rating scale: 1 Strong Sell, 2 Sell, 3 Hold, 4 Buy, 5 Strong Buy.
+-- Raw ratings are matched by rating_key(), which ignores case, spacing, dashes and underscores.
+CREATE OR REPLACE FUNCTION rating_key(rating TEXT) RETURNS TEXT
+LANGUAGE SQL IMMUTABLE AS $$
+  SELECT btrim(regexp_replace(lower(rating), '[\s_-]+', ' ', 'g'))
+$$;
+
+CREATE TABLE IF NOT EXISTS rating_mapping (
+  rating_key VARCHAR(50) PRIMARY KEY,
+  score SMALLINT NOT NULL CHECK (score BETWEEN 1 AND 5),
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+INSERT INTO rating_mapping (rating_key, score) VALUES
+  ('strong buy', 5), ('top pick', 5), ('conviction buy', 5),
+  ('buy', 4), ('outperform', 4), ('overweight', 4), ('market outperform', 4),
+  ('sector outperform', 4), ('outperformer', 4), ('moderate buy', 4),
+  ('speculative buy', 4), ('accumulate', 4), ('add', 4), ('positive', 4),
+  ('hold', 3), ('neutral', 3), ('market perform', 3), ('sector perform', 3),
+  ('peer perform', 3), ('equal weight', 3), ('sector weight', 3), ('in line', 3),
+  ('inline', 3), ('perform', 3), ('fair value', 3),
+  ('sell', 2), ('underperform', 2), ('underweight', 2), ('market underperform', 2),
+  ('sector underperform', 2), ('moderate sell', 2), ('reduce', 2), ('negative', 2),
+  ('strong sell', 1)
+ON CONFLICT (rating_key) DO NOTHING;
+
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS rating_from_score SMALLINT;
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS rating_to_score SMALLINT;
+
+-- Normalize the rows stored so far
+UPDATE analyst_recommendation ar
+SET rating_from_score = rf.score, rating_to_score = rt.score
+FROM analyst_recommendation a
+LEFT JOIN rating_mapping rf ON rf.rating_key = rating_key(a.rating_from)
+LEFT JOIN rating_mapping rt ON rt.rating_key = rating_key(a.rating_to)
+WHERE ar.id = a.id;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS analyst_recommendation_event_type_idx;
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS target_direction;
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS rating_direction;
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS event_type;
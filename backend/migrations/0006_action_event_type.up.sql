@@ -0,0 +1,7 @@
+-- Structured form of the free-text action. Directions are -1, 0 or 1, and NULL when unknown.
+-- Rows stored before this migration are classified with -reclassify-actions.
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS event_type VARCHAR(20);
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS rating_direction SMALLINT;
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS target_direction SMALLINT;
+
+CREATE INDEX IF NOT EXISTS analyst_recommendation_event_type_idx ON analyst_recommendation (event_type);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ingest_error;
+ALTER TABLE analyst_recommendation DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,18 @@
+-- Currency of target_from / target_to, NULL when the recommendation has no target
+ALTER TABLE analyst_recommendation ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE analyst_recommendation SET currency = 'USD'
+WHERE currency IS NULL AND (target_from IS NOT NULL OR target_to IS NOT NULL);
+
+-- Fields that could not be parsed on ingestion; the recommendation is saved without them
+CREATE TABLE IF NOT EXISTS ingest_error (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  source VARCHAR(50) NOT NULL,
+  fingerprint CHAR(64) NOT NULL,
+  ticker VARCHAR(10) NOT NULL,
+  field VARCHAR(50) NOT NULL,
+  raw_value TEXT NOT NULL,
+  error TEXT NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ingest_error_created_at_idx ON ingest_error (created_at DESC);
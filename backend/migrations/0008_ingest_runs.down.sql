@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ingest_dead_letter;
+DROP TABLE IF EXISTS ingest_run;
@@ -0,0 +1,35 @@
+-- Audit log of every -fetch, -import and -reprocess-failed run
+CREATE TABLE IF NOT EXISTS ingest_run (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  kind VARCHAR(20) NOT NULL,
+  source VARCHAR(50) NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  finished_at TIMESTAMPTZ,
+  pages INTEGER NOT NULL DEFAULT 0,
+  items_seen INTEGER NOT NULL DEFAULT 0,
+  inserted INTEGER NOT NULL DEFAULT 0,
+  updated INTEGER NOT NULL DEFAULT 0,
+  unchanged INTEGER NOT NULL DEFAULT 0,
+  skipped INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  status VARCHAR(20) NOT NULL DEFAULT 'running',
+  error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS ingest_run_started_at_idx ON ingest_run (started_at DESC);
+
+-- Raw items rejected by a run, kept with their error until -reprocess-failed saves them
+CREATE TABLE IF NOT EXISTS ingest_dead_letter (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  run_id UUID REFERENCES ingest_run(id) ON DELETE SET NULL,
+  source VARCHAR(50) NOT NULL,
+  stage VARCHAR(20) NOT NULL,
+  payload JSONB NOT NULL,
+  error TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  reprocessed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS ingest_dead_letter_pending_idx ON ingest_dead_letter (source, created_at)
+WHERE reprocessed_at IS NULL;
@@ -0,0 +1,12 @@
+-- Gzipped JSON items of every page fetched by a -fetch run, replayed with -replay
+CREATE TABLE IF NOT EXISTS raw_page (
+  run_id UUID REFERENCES ingest_run(id) ON DELETE CASCADE NOT NULL,
+  page INTEGER NOT NULL,
+  token TEXT NOT NULL DEFAULT '',
+  next_page TEXT NOT NULL DEFAULT '',
+  url TEXT NOT NULL DEFAULT '',
+  item_count INTEGER NOT NULL,
+  payload BYTEA NOT NULL,
+  fetched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (run_id, page)
+);
@@ -0,0 +1,15 @@
+-- Fields observed in the payloads of each sync run, compared with the schema the converter expects
+CREATE TABLE IF NOT EXISTS schema_report (
+  run_id UUID PRIMARY KEY REFERENCES ingest_run(id) ON DELETE CASCADE,
+  source VARCHAR(50) NOT NULL,
+  items INTEGER NOT NULL,
+  fields JSONB NOT NULL,
+  new_fields TEXT[] NOT NULL DEFAULT '{}',
+  missing_fields TEXT[] NOT NULL DEFAULT '{}',
+  retyped_fields TEXT[] NOT NULL DEFAULT '{}',
+  drifted BOOLEAN NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS schema_report_drifted_idx ON schema_report (source, created_at DESC)
+WHERE drifted;
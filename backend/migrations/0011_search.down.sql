@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS brokerage_name_fts_idx;
+DROP INDEX IF EXISTS brokerage_name_trgm_idx;
+DROP INDEX IF EXISTS company_name_fts_idx;
+DROP INDEX IF EXISTS company_name_trgm_idx;
+DROP INDEX IF EXISTS company_ticker_trgm_idx;
+-- pg_trgm is left installed, other objects of the database may use it
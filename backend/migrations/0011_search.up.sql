@@ -0,0 +1,9 @@
+-- Indexes of /api/v1/search: trigrams serve prefix (ILIKE 'q%') and fuzzy (%) matches,
+-- the 'simple' text search configuration serves whole word matches without stemming
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS company_ticker_trgm_idx ON company USING GIN (ticker gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS company_name_trgm_idx ON company USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS company_name_fts_idx ON company USING GIN (to_tsvector('simple', name));
+CREATE INDEX IF NOT EXISTS brokerage_name_trgm_idx ON brokerage USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS brokerage_name_fts_idx ON brokerage USING GIN (to_tsvector('simple', name));
@@ -0,0 +1,274 @@
+// Package migrations holds the versioned database schema. Every change is a pair of
+// NNNN_name.up.sql / NNNN_name.down.sql files embedded in the binary and applied in
+// version order; applied versions are tracked in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"stock-investment-backend/connection"
+	"strconv"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockID is the advisory lock key that keeps two migrators from running at once
+const lockID = 72_617_001
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+func (s MigrationStatus) Applied() bool {
+	return s.AppliedAt != nil
+}
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load returns the embedded migrations sorted by version
+func Load() ([]Migration, error) {
+	return loadFrom(files)
+}
+
+func loadFrom(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version == 0 {
+			return nil, fmt.Errorf("invalid migration file name %q, versions start at 1", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d used by both %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// plan returns the migrations to apply (ascending) and to roll back (descending)
+// to bring a database with the given applied versions to target
+func plan(migrations []Migration, applied map[int]bool, target int) (up []Migration, down []Migration) {
+	for _, m := range migrations {
+		if m.Version <= target && !applied[m.Version] {
+			up = append(up, m)
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > target && applied[m.Version] {
+			down = append(down, m)
+		}
+	}
+	return up, down
+}
+
+// Migrator applies migrations over a single database connection
+type Migrator struct {
+	conn       connection.DBConnection
+	migrations []Migration
+}
+
+func NewMigrator(conn connection.DBConnection) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, migrations: migrations}, nil
+}
+
+// Latest returns the highest known migration version
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied migration
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current, previous := 0, 0
+	for _, s := range statuses {
+		if s.Applied() {
+			previous, current = current, s.Version
+		}
+	}
+	if current == 0 {
+		return nil, nil
+	}
+	return m.To(ctx, previous)
+}
+
+// To migrates up or down until exactly the migrations up to target are applied
+func (m *Migrator) To(ctx context.Context, target int) ([]Migration, error) {
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("unknown migration version %d (latest is %d)", target, m.Latest())
+	}
+
+	_, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer m.conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	appliedAt, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]bool, len(appliedAt))
+	for version := range appliedAt {
+		applied[version] = true
+	}
+
+	up, down := plan(m.migrations, applied, target)
+
+	var ran []Migration
+	for _, migration := range down {
+		if err := m.run(ctx, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+			return ran, fmt.Errorf("rollback of %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	for _, migration := range up {
+		if err := m.run(ctx, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name); err != nil {
+			return ran, fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (m *Migrator) run(ctx context.Context, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := m.conn.BeginConn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "versions should be consecutive")
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestLoadFrom_SortsByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := loadFrom(fsys)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;"},
+	}, migrations)
+}
+
+func TestLoadFrom_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected string
+	}{
+		{
+			name:     "Invalid file name",
+			fsys:     fstest.MapFS{"create_tables.sql": {Data: []byte("")}},
+			expected: "invalid migration file name",
+		},
+		{
+			name:     "Version zero",
+			fsys:     fstest.MapFS{"0000_zero.up.sql": {Data: []byte("")}},
+			expected: "versions start at 1",
+		},
+		{
+			name:     "Missing down file",
+			fsys:     fstest.MapFS{"0001_first.up.sql": {Data: []byte("CREATE TABLE a ();")}},
+			expected: "needs both an up and a down file",
+		},
+		{
+			name: "Duplicate version",
+			fsys: fstest.MapFS{
+				"0001_first.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+				"0001_other.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			expected: "used by both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadFrom(tt.fsys)
+
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+
+	versions := func(ms []Migration) []int {
+		result := []int{}
+		for _, m := range ms {
+			result = append(result, m.Version)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name         string
+		applied      map[int]bool
+		target       int
+		expectedUp   []int
+		expectedDown []int
+	}{
+		{
+			name:         "Fresh database up to latest",
+			applied:      map[int]bool{},
+			target:       4,
+			expectedUp:   []int{1, 2, 3, 4},
+			expectedDown: []int{},
+		},
+		{
+			name:         "Partially migrated up to a version",
+			applied:      map[int]bool{1: true},
+			target:       3,
+			expectedUp:   []int{2, 3},
+			expectedDown: []int{},
+		},
+		{
+			name:         "Roll back in reverse order",
+			applied:      map[int]bool{1: true, 2: true, 3: true, 4: true},
+			target:       1,
+			expectedUp:   []int{},
+			expectedDown: []int{4, 3, 2},
+		},
+		{
+			name:         "Fill a gap below the target",
+			applied:      map[int]bool{1: true, 3: true},
+			target:       4,
+			expectedUp:   []int{2, 4},
+			expectedDown: []int{},
+		},
+		{
+			name:         "Already at target",
+			applied:      map[int]bool{1: true, 2: true},
+			target:       2,
+			expectedUp:   []int{},
+			expectedDown: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, down := plan(migrations, tt.applied, tt.target)
+
+			assert.Equal(t, tt.expectedUp, versions(up))
+			assert.Equal(t, tt.expectedDown, versions(down))
+		})
+	}
+}
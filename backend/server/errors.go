@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+
+	"stock-investment-backend/service"
+
+	"github.com/jackc/pgconn"
+)
+
+// Problem is an RFC 7807 error body, sent as application/problem+json
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// RequestID is also sent in the X-Request-ID header, and logged with server errors
+	RequestID string `json:"request_id,omitempty"`
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts the ids of proxies and clients that are safe to log and echo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware keeps the X-Request-ID of the request, or generates one,
+// and echoes it in the response
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// errorStatus maps the kinds of service errors to HTTP statuses
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// sendServiceError answers with the status of err. The messages of server
+// errors may hold SQL or connection details, and those of database errors SQL
+// types and SQLSTATEs whatever their status, so they are only logged.
+func sendServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	detail := err.Error()
+	var pgErr *pgconn.PgError
+	switch {
+	case status == http.StatusServiceUnavailable:
+		detail = "A service the API depends on is unavailable, try again later"
+	case status == http.StatusInternalServerError:
+		detail = "The request could not be processed"
+	case status == http.StatusConflict && errors.As(err, &pgErr):
+		detail = "The request conflicts with stored data"
+	case errors.As(err, &pgErr):
+		detail = "The request has a value the database cannot read, e.g. an id that is not a UUID"
+	}
+	switch {
+	case status >= 500:
+		log.Printf("❌ %s %s failed (request %s): %v", r.Method, r.URL.Path, w.Header().Get(requestIDHeader), err)
+	case pgErr != nil:
+		log.Printf("⚠️  %s %s rejected by the database (request %s): %v", r.Method, r.URL.Path, w.Header().Get(requestIDHeader), err)
+	}
+	sendErrorResponse(w, status, detail)
+}
+
+func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(statusCode),
+		Status:    statusCode,
+		Detail:    message,
+		RequestID: w.Header().Get(requestIDHeader),
+	})
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"stock-investment-backend/service"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore fails ListBrokerages with err
+type failingStore struct {
+	service.Store
+	err error
+}
+
+func (s failingStore) ListBrokerages(ctx context.Context) ([]service.Brokerage, error) {
+	return nil, s.err
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("company X: %w", service.ErrNotFound), http.StatusNotFound},
+		{fmt.Errorf("sort: %w", service.ErrInvalidInput), http.StatusBadRequest},
+		{fmt.Errorf("insert: %w", service.ErrConflict), http.StatusConflict},
+		{fmt.Errorf("pool: %w", service.ErrUnavailable), http.StatusServiceUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, errorStatus(tt.err), tt.err.Error())
+	}
+}
+
+func TestGetCompanyByTicker_NotFound(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/companies/NOPE", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	//problemOf fails if a success body follows the problem
+	problem := problemOf(t, rec)
+	assert.Equal(t, "Not Found", problem.Title)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Contains(t, problem.Detail, "NOPE")
+	assert.NotEmpty(t, problem.RequestID)
+	assert.Equal(t, rec.Header().Get("X-Request-ID"), problem.RequestID)
+}
+
+func TestGetRecommendations_InvalidBrokerageID(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	for _, path := range []string{
+		"/api/v1/recommendations/brokerage/not-a-uuid",
+		"/api/v1/recommendations?brokerage_id=42",
+		"/api/v1/recommendations/export?brokerage_id=42",
+	} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+		assert.Contains(t, problemOf(t, rec).Detail, "invalid brokerage id", path)
+	}
+}
+
+func TestServerErrorsHideDetails(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New(`query failed: ERROR: relation "brokerage" does not exist (SQLSTATE 42P01)`), http.StatusInternalServerError},
+		{fmt.Errorf("database connection failed: dial tcp 10.0.0.5:5432: %w", service.ErrUnavailable), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		srv := NewServer(failingStore{Store: service.NewMemoryStore(), err: tt.err}, service.DefaultScoringProfiles())
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/brokerages", nil))
+
+		assert.Equal(t, tt.want, rec.Code)
+		problem := problemOf(t, rec)
+		assert.NotContains(t, problem.Detail, "brokerage")
+		assert.NotContains(t, problem.Detail, "5432")
+	}
+}
+
+func TestDatabaseClientErrorsHideDetails(t *testing.T) {
+	//Shaped like the errors of the service's dbError: a kind wrapping the error of the driver
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: scan failed: %w", service.ErrInvalidInput,
+			&pgconn.PgError{Severity: "ERROR", Code: "22P02", Message: `invalid input syntax for type uuid: "42"`}), http.StatusBadRequest},
+		{fmt.Errorf("%w: insert failed: %w", service.ErrConflict,
+			&pgconn.PgError{Severity: "ERROR", Code: "23505", Message: `duplicate key value violates unique constraint "brokerage_name_key"`}), http.StatusConflict},
+	}
+	for _, tt := range tests {
+		require.Contains(t, tt.err.Error(), "SQLSTATE")
+		srv := NewServer(failingStore{Store: service.NewMemoryStore(), err: tt.err}, service.DefaultScoringProfiles())
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/brokerages", nil))
+
+		assert.Equal(t, tt.want, rec.Code)
+		problem := problemOf(t, rec)
+		assert.NotEmpty(t, problem.Detail)
+		assert.NotContains(t, problem.Detail, "SQLSTATE")
+		assert.NotContains(t, problem.Detail, "failed")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/search", nil)
+	req.Header.Set("X-Request-ID", "client-42")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	assert.Equal(t, "client-42", rec.Header().Get("X-Request-ID"))
+	assert.Equal(t, "client-42", problemOf(t, rec).RequestID)
+
+	//Ids that are unsafe to log are replaced
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/companies", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Regexp(t, "^[0-9a-f]{24}$", rec.Header().Get("X-Request-ID"))
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/nope", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotEmpty(t, problemOf(t, rec).RequestID)
+}
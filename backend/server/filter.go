@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"stock-investment-backend/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRecommendationFilter reads the filters and sort order shared by
+// getRecommendations and exportRecommendations. Pagination is left to the caller.
+func parseRecommendationFilter(r *http.Request, now time.Time) (service.RecommendationFilter, error) {
+	query := r.URL.Query()
+	filter := service.RecommendationFilter{
+		BrokerageID: query.Get("brokerage_id"),
+		Source:      query.Get("source"),
+		Actions:     parseListParam(query.Get("action")),
+		RatingsTo:   parseListParam(query.Get("rating_to")),
+		Company:     strings.TrimSpace(query.Get("company")),
+	}
+
+	//ticker=AAPL,MSFT matches either ticker
+	tickers := parseListParam(query.Get("ticker"))
+	for i, ticker := range tickers {
+		tickers[i] = strings.ToUpper(ticker)
+	}
+	if len(tickers) == 1 {
+		filter.Ticker = tickers[0]
+	} else {
+		filter.Tickers = tickers
+	}
+
+	var err error
+	if filter.EventType, err = parseEventTypeParam(r); err != nil {
+		return filter, err
+	}
+	//sort=-target_change,ticker sorts by several keys, "-" for descending
+	if filter.Sort, err = service.ParseSort(query.Get("sort"), service.RecommendationSortFields); err != nil {
+		return filter, err
+	}
+
+	if filter.From, err = parseTimeParam(query.Get("from"), false); err != nil {
+		return filter, fmt.Errorf("invalid from: %w", err)
+	}
+	if filter.To, err = parseTimeParam(query.Get("to"), true); err != nil {
+		return filter, fmt.Errorf("invalid to: %w", err)
+	}
+	if since := query.Get("since"); since != "" {
+		if filter.From != nil {
+			return filter, fmt.Errorf("since and from cannot be combined")
+		}
+		window, err := parseSince(since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+		from := now.Add(-window)
+		filter.From = &from
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	bounds := []struct {
+		min, max   string
+		minP, maxP **float64
+	}{
+		{"min_target", "max_target", &filter.MinTarget, &filter.MaxTarget},
+		{"min_target_change", "max_target_change", &filter.MinTargetChange, &filter.MaxTargetChange},
+	}
+	for _, b := range bounds {
+		if *b.minP, err = parseFloatParam(query, b.min); err != nil {
+			return filter, err
+		}
+		if *b.maxP, err = parseFloatParam(query, b.max); err != nil {
+			return filter, err
+		}
+		if *b.minP != nil && *b.maxP != nil && **b.minP > **b.maxP {
+			return filter, fmt.Errorf("%s must not be greater than %s", b.min, b.max)
+		}
+	}
+	return filter, nil
+}
+
+// parseListParam splits a comma separated parameter, dropping empty values
+func parseListParam(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseTimeParam accepts RFC 3339 timestamps and YYYY-MM-DD dates. A date
+// used as an exclusive upper bound (endOfDay) includes the whole day.
+func parseTimeParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an RFC 3339 time nor a YYYY-MM-DD date", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// maxSinceDays bounds since windows, far longer ones would overflow time.Duration
+const maxSinceDays = 3650
+
+// parseSince parses windows such as 7d, 2w or 36h, up to maxSinceDays
+func parseSince(value string) (time.Duration, error) {
+	tooLong := fmt.Errorf("%q is longer than the %d days a window can span", value, maxSinceDays)
+	var window time.Duration
+	if n, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && strings.HasSuffix(value, "d") {
+		if n > maxSinceDays {
+			return 0, tooLong
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else if n, err := strconv.Atoi(strings.TrimSuffix(value, "w")); err == nil && strings.HasSuffix(value, "w") {
+		if n > maxSinceDays {
+			return 0, tooLong
+		}
+		window = time.Duration(n) * 7 * 24 * time.Hour
+	} else if d, err := time.ParseDuration(value); err == nil {
+		window = d
+	} else {
+		return 0, fmt.Errorf("%q is not a window such as 7d, 2w or 36h", value)
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("%q must be positive", value)
+	}
+	if window > maxSinceDays*24*time.Hour {
+		return 0, tooLong
+	}
+	return window, nil
+}
+
+// parseFloatParam reads an optional number parameter
+func parseFloatParam(query url.Values, name string) (*float64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+	return &f, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stock-investment-backend/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRecommendationFilter(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	at := func(s string) *time.Time {
+		parsed, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return &parsed
+	}
+	num := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name  string
+		query string
+		want  service.RecommendationFilter
+	}{
+		{"empty", "", service.RecommendationFilter{}},
+		{"single ticker", "ticker=aapl", service.RecommendationFilter{Ticker: "AAPL"}},
+		{"ticker list", "ticker=AAPL,%20msft,", service.RecommendationFilter{Tickers: []string{"AAPL", "MSFT"}}},
+		{"actions and ratings", "action=upgraded%20by,downgraded%20by&rating_to=Buy", service.RecommendationFilter{
+			Actions: []string{"upgraded by", "downgraded by"}, RatingsTo: []string{"Buy"},
+		}},
+		{"date range", "from=2025-01-01&to=2025-01-10", service.RecommendationFilter{
+			From: at("2025-01-01T00:00:00Z"), To: at("2025-01-11T00:00:00Z"),
+		}},
+		{"timestamps", "from=2025-01-01T10:00:00Z&to=2025-01-02T10:00:00Z", service.RecommendationFilter{
+			From: at("2025-01-01T10:00:00Z"), To: at("2025-01-02T10:00:00Z"),
+		}},
+		{"since days", "since=7d", service.RecommendationFilter{From: at("2025-01-08T12:00:00Z")}},
+		{"since weeks", "since=2w", service.RecommendationFilter{From: at("2025-01-01T12:00:00Z")}},
+		{"since hours", "since=36h", service.RecommendationFilter{From: at("2025-01-14T00:00:00Z")}},
+		{"since ten years", "since=3650d", service.RecommendationFilter{From: at("2015-01-18T12:00:00Z")}},
+		{"targets", "min_target=10.5&max_target=200&min_target_change=-5&max_target_change=25", service.RecommendationFilter{
+			MinTarget: num(10.5), MaxTarget: num(200), MinTargetChange: num(-5), MaxTargetChange: num(25),
+		}},
+		{"company", "company=%20apple%20", service.RecommendationFilter{Company: "apple"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/recommendations?"+tt.query, nil)
+
+			filter, err := parseRecommendationFilter(r, now)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, filter)
+		})
+	}
+}
+
+func TestParseRecommendationFilter_Errors(t *testing.T) {
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2025-13-01",
+		"since=7x",
+		"since=-2d",
+		"since=200000d",
+		"since=3651d",
+		"since=9223372036854775807w",
+		"since=87601h",
+		"since=7d&from=2025-01-01",
+		"from=2025-01-10&to=2025-01-01",
+		"min_target=cheap",
+		"max_target_change=NaN",
+		"min_target=50&max_target=10",
+		"min_target_change=10&max_target_change=-10",
+		"event_type=rumor",
+	} {
+		t.Run(query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/recommendations?"+query, nil)
+
+			_, err := parseRecommendationFilter(r, time.Now())
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -2,8 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"stock-investment-backend/service"
 
@@ -14,20 +18,29 @@ import (
 type APIResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
 	Meta    *Meta       `json:"meta,omitempty"`
 }
 
 type Meta struct {
-	Total  int `json:"total"`
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
+	// Total is left out when the client skipped the count with count=false
+	Total  *int `json:"total,omitempty"`
+	Limit  int  `json:"limit"`
+	Offset int  `json:"offset"`
+	// NextCursor and PrevCursor page through listings sorted by time, see getRecommendations
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 func (s *Server) getCompanies(w http.ResponseWriter, r *http.Request) {
-	companies, err := service.GetAllCompanies()
+	sort, err := service.ParseSort(r.URL.Query().Get("sort"), service.CompanySortFields)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		sendServiceError(w, r, err)
+		return
+	}
+
+	companies, err := s.store.ListCompanies(r.Context(), sort)
+	if err != nil {
+		sendServiceError(w, r, err)
 		return
 	}
 
@@ -38,29 +51,67 @@ func (s *Server) getCompanyByTicker(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	ticker := vars["ticker"]
 
-	company, err := service.GetCompanyByTicker(ticker)
+	company, err := s.store.GetCompanyByTicker(r.Context(), ticker)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		sendServiceError(w, r, err)
+		return
 	}
 
 	sendSuccessResponse(w, company, nil)
 }
 
 func (s *Server) getBrokerages(w http.ResponseWriter, r *http.Request) {
-	brokerages, err := service.GetAllBrokerages()
+	brokerages, err := s.store.ListBrokerages(r.Context())
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		sendServiceError(w, r, err)
 		return
 	}
 
 	sendSuccessResponse(w, brokerages, nil)
 }
 
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(q) > 100 {
+		sendErrorResponse(w, http.StatusBadRequest, "q must not be longer than 100 characters")
+		return
+	}
+	kind, err := service.ParseSearchKind(r.URL.Query().Get("type"))
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 50 {
+			limit = l
+		}
+	}
+
+	results, err := s.store.Search(r.Context(), service.SearchQuery{Text: q, Type: kind, Limit: limit})
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	total := len(results)
+	sendSuccessResponse(w, results, &Meta{Total: &total, Limit: limit})
+}
+
 func (s *Server) getRecommendations(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
-	ticker := r.URL.Query().Get("ticker")
-	brokerageID := r.URL.Query().Get("brokerage_id")
+
+	filter, err := parseRecommendationFilter(r, time.Now())
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	limit := 50
 	offset := 0
@@ -77,21 +128,116 @@ func (s *Server) getRecommendations(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	recommendations, total, err := service.GetRecommendations(limit, offset, ticker, brokerageID)
+	//cursor=<token> pages from next_cursor or prev_cursor, offset stays for older clients.
+	//The stores reject cursors with other sorts or an offset.
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		if filter.Cursor, err = service.DecodeCursor(token); err != nil {
+			sendServiceError(w, r, err)
+			return
+		}
+	}
+	if count := r.URL.Query().Get("count"); count != "" {
+		counted, err := strconv.ParseBool(count)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "count must be true or false")
+			return
+		}
+		filter.SkipCount = !counted
+	}
+
+	//One extra row tells whether there is a page beyond this one
+	filter.Limit = limit + 1
+	filter.Offset = offset
+	recommendations, total, err := s.store.ListRecommendations(r.Context(), filter)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		sendServiceError(w, r, err)
 		return
 	}
 
 	meta := &Meta{
-		Total:  total,
 		Limit:  limit,
 		Offset: offset,
 	}
+	if total >= 0 {
+		meta.Total = &total
+	}
+	recommendations = pageCursors(meta, recommendations, filter, limit)
 
 	sendSuccessResponse(w, recommendations, meta)
 }
 
+// pageCursors trims the extra row read by getRecommendations and sets the
+// cursors of the neighbouring pages, for listings sorted by time
+func pageCursors(meta *Meta, recommendations []service.Recommendation, filter service.RecommendationFilter, limit int) []service.Recommendation {
+	backwards := filter.Cursor != nil && filter.Cursor.Before
+	more := len(recommendations) > limit
+	if more {
+		//Pages read backwards end at the cursor, so the extra row is the first one
+		if backwards {
+			recommendations = recommendations[1:]
+		} else {
+			recommendations = recommendations[:limit]
+		}
+	}
+
+	if _, ok := service.CursorSort(filter.Sort); !ok || len(recommendations) == 0 {
+		return recommendations
+	}
+	hasNext := more || backwards
+	hasPrev := (more && backwards) || (!backwards && (filter.Cursor != nil || filter.Offset > 0))
+	if hasNext {
+		meta.NextCursor = service.NewCursor(recommendations[len(recommendations)-1], false).Encode()
+	}
+	if hasPrev {
+		meta.PrevCursor = service.NewCursor(recommendations[0], true).Encode()
+	}
+	return recommendations
+}
+
+// parseEventTypeParam reads the optional event_type query parameter
+func parseEventTypeParam(r *http.Request) (service.EventType, error) {
+	value := r.URL.Query().Get("event_type")
+	if value == "" {
+		return "", nil
+	}
+	return service.ParseEventType(value)
+}
+
+// exportRecommendations streams every recommendation matching the same filters
+// as getRecommendations, without pagination, as a CSV or NDJSON download
+func (s *Server) exportRecommendations(w http.ResponseWriter, r *http.Request) {
+	formatStr := r.URL.Query().Get("format")
+	if formatStr == "" {
+		formatStr = string(service.FormatCSV)
+	}
+	format, err := service.ParseFileFormat(formatStr)
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	filter, err := parseRecommendationFilter(r, time.Now())
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	//Once the download starts errors can no longer be reported
+	if err := filter.Validate(); err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("recommendations-%s.%s", time.Now().UTC().Format("20060102"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	count, err := service.ExportRecommendations(r.Context(), s.store, filter, format, w)
+	if err != nil {
+		//Headers and part of the body are already sent, the client sees a truncated file
+		log.Printf("❌ Export failed after %d rows: %v", count, err)
+	}
+}
+
 func (s *Server) getRecommendationsByTicker(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	ticker := vars["ticker"]
@@ -114,14 +260,18 @@ func (s *Server) getRecommendationsByTicker(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	recommendations, total, err := service.GetRecommendations(limit, offset, ticker, "")
+	recommendations, total, err := s.store.ListRecommendations(r.Context(), service.RecommendationFilter{
+		Ticker: ticker,
+		Limit:  limit,
+		Offset: offset,
+	})
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		sendServiceError(w, r, err)
 		return
 	}
 
 	meta := &Meta{
-		Total:  total,
+		Total:  &total,
 		Limit:  limit,
 		Offset: offset,
 	}
@@ -152,14 +302,18 @@ func (s *Server) getRecommendationsByBrokerage(w http.ResponseWriter, r *http.Re
 		}
 	}
 
-	recommendations, total, err := service.GetRecommendations(limit, offset, "", brokerageID)
+	recommendations, total, err := s.store.ListRecommendations(r.Context(), service.RecommendationFilter{
+		BrokerageID: brokerageID,
+		Limit:       limit,
+		Offset:      offset,
+	})
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		sendServiceError(w, r, err)
 		return
 	}
 
 	meta := &Meta{
-		Total:  total,
+		Total:  &total,
 		Limit:  limit,
 		Offset: offset,
 	}
@@ -167,6 +321,200 @@ func (s *Server) getRecommendationsByBrokerage(w http.ResponseWriter, r *http.Re
 	sendSuccessResponse(w, recommendations, meta)
 }
 
+// getScores ranks every company with the investment scoring model, best first
+func (s *Server) getScores(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.profiles.Get(r.URL.Query().Get("profile"))
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	scores, err := service.ComputeScores(r.Context(), s.store, profile, time.Now())
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	total := len(scores)
+	limit := total
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l < total {
+			limit = l
+		}
+	}
+
+	meta := &Meta{
+		Total:  &total,
+		Limit:  limit,
+		Offset: 0,
+	}
+
+	sendSuccessResponse(w, scores[:limit], meta)
+}
+
+func (s *Server) getScoreByTicker(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ticker := vars["ticker"]
+
+	profile, err := s.profiles.Get(r.URL.Query().Get("profile"))
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	score, err := service.ComputeScore(r.Context(), s.store, ticker, profile, time.Now())
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	sendSuccessResponse(w, score, nil)
+}
+
+func (s *Server) getRatingMappings(w http.ResponseWriter, r *http.Request) {
+	mappings, err := s.store.ListRatingMappings(r.Context())
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	sendSuccessResponse(w, mappings, nil)
+}
+
+// putRatingMapping maps a raw rating to the canonical scale and renormalizes
+// the stored recommendations using it
+func (s *Server) putRatingMapping(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rating := vars["rating"]
+
+	var body struct {
+		Score int `json:"score"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	key, err := service.ValidateRatingMapping(rating, body.Score)
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	updated, err := s.store.SetRatingMapping(r.Context(), rating, body.Score)
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"rating_key":              key,
+		"score":                   body.Score,
+		"label":                   service.RatingLabel(body.Score),
+		"updated_recommendations": updated,
+	}, nil)
+}
+
+// getUnmappedRatings lists the stored raw ratings without a mapping, most frequent first
+func (s *Server) getUnmappedRatings(w http.ResponseWriter, r *http.Request) {
+	unmapped, err := s.store.ListUnmappedRatings(r.Context())
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	sendSuccessResponse(w, unmapped, nil)
+}
+
+func (s *Server) getIngestRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	runs, total, err := s.store.ListIngestRuns(r.Context(), limit, offset)
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	meta := &Meta{
+		Total:  &total,
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	sendSuccessResponse(w, runs, meta)
+}
+
+func (s *Server) getSchemaReports(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	filter := service.SchemaReportFilter{Source: r.URL.Query().Get("source")}
+	if drifted := r.URL.Query().Get("drifted"); drifted != "" {
+		b, err := strconv.ParseBool(drifted)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "drifted must be true or false")
+			return
+		}
+		filter.DriftedOnly = b
+	}
+
+	reports, total, err := s.store.ListSchemaReports(r.Context(), filter, limit, offset)
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+
+	meta := &Meta{
+		Total:  &total,
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	sendSuccessResponse(w, reports, meta)
+}
+
+// SyncStatusResponse is the body of /admin/sync-status
+type SyncStatusResponse struct {
+	Scheduled     bool                     `json:"scheduled"`
+	Scheduler     *service.SchedulerStatus `json:"scheduler,omitempty"`
+	LastIngestRun *service.IngestRun       `json:"last_ingest_run"`
+}
+
+func (s *Server) getSyncStatus(w http.ResponseWriter, r *http.Request) {
+	var status SyncStatusResponse
+	if s.scheduler != nil {
+		scheduler := s.scheduler.Status()
+		status.Scheduled = true
+		status.Scheduler = &scheduler
+	}
+
+	//The latest run may come from another process, e.g. a -daemon next to the API
+	runs, _, err := s.store.ListIngestRuns(r.Context(), 1, 0)
+	if err != nil {
+		sendServiceError(w, r, err)
+		return
+	}
+	if len(runs) > 0 {
+		status.LastIngestRun = &runs[0]
+	}
+
+	sendSuccessResponse(w, status, nil)
+}
+
 func sendSuccessResponse(w http.ResponseWriter, data interface{}, meta *Meta) {
 	w.Header().Set("Content-Type", "application/json")
 	response := APIResponse{
@@ -176,13 +524,3 @@ func sendSuccessResponse(w http.ResponseWriter, data interface{}, meta *Meta) {
 	}
 	json.NewEncoder(w).Encode(response)
 }
-
-func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	response := APIResponse{
-		Success: false,
-		Error:   message,
-	}
-	json.NewEncoder(w).Encode(response)
-}
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-investment-backend/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*Server, *service.MemoryStore) {
+	store := service.NewMemoryStore()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var data []service.RecommendationData
+	for i, ticker := range []string{"AAPL", "MSFT", "AAPL"} {
+		data = append(data, service.RecommendationData{
+			Ticker:     ticker,
+			Company:    ticker + " Inc.",
+			Action:     "upgraded by",
+			Brokerage:  "Goldman Sachs",
+			RatingFrom: "Hold",
+			RatingTo:   "Buy",
+			TargetFrom: "$100.00",
+			TargetTo:   "$120.00",
+			Time:       start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	_, err := store.UpsertRecommendations(context.Background(), data, service.SaveOptions{})
+	require.NoError(t, err)
+
+	profiles := service.DefaultScoringProfiles()
+	recent := service.DefaultScoringProfile()
+	recent.Name = "recent"
+	recent.RecencyHalfLifeDays = 7
+	profiles[recent.Name] = recent
+
+	return NewServer(store, profiles), store
+}
+
+func doRequest(t *testing.T, srv *Server, path string) (*httptest.ResponseRecorder, APIResponse) {
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body APIResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec, body
+}
+
+func intPtr(i int) *int { return &i }
+
+// problemOf decodes the problem+json body of a failed request
+func problemOf(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	require.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	return problem
+}
+
+func TestGetCompanies(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/companies")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, body.Success)
+	assert.Len(t, body.Data, 2)
+}
+
+func TestGetCompanies_Sort(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/companies?sort=-ticker")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	companies := body.Data.([]interface{})
+	require.Len(t, companies, 2)
+	assert.Equal(t, "MSFT", companies[0].(map[string]interface{})["ticker"])
+
+	rec, body = doRequest(t, srv, "/api/v1/companies?sort=market_cap")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, problemOf(t, rec).Detail, "cannot sort by")
+}
+
+func TestGetRecommendations_Sort(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/recommendations?sort=ticker,-time")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tickers []string
+	var times []string
+	for _, item := range body.Data.([]interface{}) {
+		r := item.(map[string]interface{})
+		tickers = append(tickers, r["company"].(map[string]interface{})["ticker"].(string))
+		times = append(times, r["time"].(string))
+	}
+	assert.Equal(t, []string{"AAPL", "AAPL", "MSFT"}, tickers)
+	assert.Equal(t, "2025-01-01T02:00:00Z", times[0])
+
+	rec, _ = doRequest(t, srv, "/api/v1/recommendations?sort=-price")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = doRequest(t, srv, "/api/v1/recommendations/export?sort=-price")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGetRecommendations_Paginated(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/recommendations?limit=2&ticker=AAPL")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, body.Data, 2)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, Meta{Total: intPtr(2), Limit: 2, Offset: 0}, *body.Meta)
+}
+
+func TestGetRecommendations_EventType(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/recommendations?event_type=upgrade")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, 3, *body.Meta.Total)
+
+	rec, body = doRequest(t, srv, "/api/v1/recommendations?event_type=downgrade")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, *body.Meta.Total)
+
+	rec, body = doRequest(t, srv, "/api/v1/recommendations?event_type=sideways")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.False(t, body.Success)
+}
+
+func TestGetRecommendations_Filters(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	tests := []struct {
+		query string
+		total int
+	}{
+		{"ticker=AAPL,MSFT", 3},
+		{"ticker=aapl", 2},
+		{"from=2025-01-01T01:00:00Z", 2},
+		{"to=2025-01-01T01:00:00Z", 1},
+		{"from=2025-01-01&to=2025-01-01", 3},
+		{"since=1d", 0},
+		{"action=UPGRADED%20BY,downgraded%20by", 3},
+		{"rating_to=sell", 0},
+		{"min_target=120&max_target=120", 3},
+		{"max_target=119.99", 0},
+		{"min_target_change=20", 3},
+		{"min_target_change=20.01", 0},
+		{"company=msft", 1},
+		{"company=%25", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec, body := doRequest(t, srv, "/api/v1/recommendations?"+tt.query)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			require.NotNil(t, body.Meta)
+			assert.Equal(t, tt.total, *body.Meta.Total)
+		})
+	}
+
+	for _, since := range []string{"soon", "200000d"} {
+		rec, body := doRequest(t, srv, "/api/v1/recommendations?since="+since)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, since)
+		assert.False(t, body.Success)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/recommendations?since=200000d", nil))
+	assert.Contains(t, problemOf(t, rec).Detail, "3650 days")
+}
+
+func TestGetRecommendations_Cursor(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	page := func(query string) ([]string, *Meta) {
+		rec, body := doRequest(t, srv, "/api/v1/recommendations?limit=1&"+query)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, body.Meta)
+		var times []string
+		for _, item := range body.Data.([]interface{}) {
+			times = append(times, item.(map[string]interface{})["time"].(string))
+		}
+		return times, body.Meta
+	}
+
+	first, meta := page("")
+	assert.Equal(t, []string{"2025-01-01T02:00:00Z"}, first)
+	assert.Equal(t, intPtr(3), meta.Total)
+	assert.Empty(t, meta.PrevCursor)
+	require.NotEmpty(t, meta.NextCursor)
+
+	second, meta := page("count=false&cursor=" + meta.NextCursor)
+	assert.Equal(t, []string{"2025-01-01T01:00:00Z"}, second)
+	assert.Nil(t, meta.Total, "count=false skips the total")
+	require.NotEmpty(t, meta.PrevCursor)
+	require.NotEmpty(t, meta.NextCursor)
+	prev := meta.PrevCursor
+
+	last, meta := page("cursor=" + meta.NextCursor)
+	assert.Equal(t, []string{"2025-01-01T00:00:00Z"}, last)
+	assert.Empty(t, meta.NextCursor)
+	require.NotEmpty(t, meta.PrevCursor)
+
+	back, meta := page("cursor=" + meta.PrevCursor)
+	assert.Equal(t, second, back)
+	assert.NotEmpty(t, meta.NextCursor)
+	assert.NotEmpty(t, meta.PrevCursor)
+
+	back, meta = page("cursor=" + prev)
+	assert.Equal(t, first, back)
+	assert.Empty(t, meta.PrevCursor)
+	assert.NotEmpty(t, meta.NextCursor)
+
+	_, meta = page("sort=ticker")
+	assert.Empty(t, meta.NextCursor, "only listings sorted by time have cursors")
+
+	for _, query := range []string{"cursor=garbage", "cursor=" + prev + "&sort=ticker", "cursor=" + prev + "&offset=1", "count=maybe"} {
+		rec, body := doRequest(t, srv, "/api/v1/recommendations?"+query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.False(t, body.Success)
+	}
+}
+
+func TestGetRecommendationsByBrokerage(t *testing.T) {
+	srv, store := newTestServer(t)
+	brokerages, err := store.ListBrokerages(context.Background())
+	require.NoError(t, err)
+
+	rec, body := doRequest(t, srv, "/api/v1/recommendations/brokerage/"+brokerages[0].ID)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, 3, *body.Meta.Total)
+}
+
+func TestSearch(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/search?q=msft")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	results := body.Data.([]interface{})
+	require.Len(t, results, 1)
+	result := results[0].(map[string]interface{})
+	assert.Equal(t, "company", result["type"])
+	assert.Equal(t, "MSFT", result["ticker"])
+	assert.Equal(t, "ticker", result["match"])
+
+	rec, body = doRequest(t, srv, "/api/v1/search?q=goldman+sacks&type=brokerage")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	results = body.Data.([]interface{})
+	require.Len(t, results, 1)
+	assert.Equal(t, "fuzzy", results[0].(map[string]interface{})["match"])
+
+	rec, body = doRequest(t, srv, "/api/v1/search?q=inc&limit=1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, body.Data, 1)
+
+	for _, path := range []string{"/api/v1/search", "/api/v1/search?q=+", "/api/v1/search?q=aapl&type=ticker"} {
+		rec, _ = doRequest(t, srv, path)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+	}
+}
+
+func TestExportRecommendations(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		lines       int
+	}{
+		{name: "CSV by default", path: "/api/v1/recommendations/export", contentType: "text/csv; charset=utf-8", lines: 4},
+		{name: "NDJSON filtered", path: "/api/v1/recommendations/export?format=ndjson&ticker=AAPL", contentType: "application/x-ndjson", lines: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment; filename=\"recommendations-")
+			assert.Len(t, strings.Split(strings.TrimSpace(rec.Body.String()), "\n"), tt.lines)
+		})
+	}
+
+	rec, body := doRequest(t, srv, "/api/v1/recommendations/export?format=xlsx")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.False(t, body.Success)
+}
+
+func TestGetScores(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/scores?limit=1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, body.Data, 1)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, 2, *body.Meta.Total)
+
+	rec, body = doRequest(t, srv, "/api/v1/scores/AAPL")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	score := body.Data.(map[string]interface{})
+	assert.Equal(t, "AAPL", score["ticker"])
+	assert.Contains(t, score, "metrics")
+
+	rec, body = doRequest(t, srv, "/api/v1/scores/NOPE")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.False(t, body.Success)
+
+	rec, body = doRequest(t, srv, "/api/v1/scores/AAPL?profile=recent")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "recent", body.Data.(map[string]interface{})["profile"])
+
+	rec, _ = doRequest(t, srv, "/api/v1/scores?profile=unknown")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, problemOf(t, rec).Detail, "unknown scoring profile")
+}
+
+func TestRatingMappings(t *testing.T) {
+	srv, store := newTestServer(t)
+	_, err := store.UpsertRecommendations(context.Background(), []service.RecommendationData{{
+		Ticker:     "NVDA",
+		Company:    "NVIDIA",
+		Action:     "initiated by",
+		RatingFrom: "Sector Outperformer",
+		RatingTo:   "Sector Outperformer",
+		Time:       time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+	}}, service.SaveOptions{})
+	require.NoError(t, err)
+
+	rec, body := doRequest(t, srv, "/api/v1/ratings/unmapped")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []interface{}{map[string]interface{}{"rating": "Sector Outperformer", "occurrences": float64(2)}}, body.Data)
+
+	put := func(path, payload string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path, strings.NewReader(payload)))
+		return rec
+	}
+
+	rec = put("/api/v1/ratings/mappings/Sector%20Outperformer", `{"score": 4}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"updated_recommendations":1`)
+
+	rec = put("/api/v1/ratings/mappings/Hold", `{"score": 9}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, body = doRequest(t, srv, "/api/v1/ratings/unmapped")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, body.Data)
+
+	_, body = doRequest(t, srv, "/api/v1/recommendations?ticker=NVDA")
+	recommendation := body.Data.([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(service.RatingBuy), recommendation["rating_to_score"])
+}
+
+func TestGetIngestRuns(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/admin/ingest-runs?limit=5")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, body.Data)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, Meta{Total: intPtr(0), Limit: 5, Offset: 0}, *body.Meta)
+}
+
+func TestGetSyncStatus(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/admin/sync-status")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	status := body.Data.(map[string]interface{})
+	assert.Equal(t, false, status["scheduled"])
+	assert.NotContains(t, status, "scheduler")
+	assert.Nil(t, status["last_ingest_run"])
+
+	sched, err := service.NewScheduler("@every 30m", func() service.SyncResult { return service.SyncResult{} })
+	require.NoError(t, err)
+	srv.SetScheduler(sched)
+
+	rec, body = doRequest(t, srv, "/api/v1/admin/sync-status")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	status = body.Data.(map[string]interface{})
+	assert.Equal(t, true, status["scheduled"])
+	scheduler := status["scheduler"].(map[string]interface{})
+	assert.Equal(t, "@every 30m", scheduler["schedule"])
+	assert.Equal(t, false, scheduler["running"])
+	assert.Nil(t, scheduler["last_run"])
+}
+
+func TestGetSchemaReports(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec, body := doRequest(t, srv, "/api/v1/admin/schema-drift?drifted=true&source=api")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, body.Data)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, Meta{Total: intPtr(0), Limit: 20, Offset: 0}, *body.Meta)
+
+	rec, body = doRequest(t, srv, "/api/v1/admin/schema-drift?drifted=maybe")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.False(t, body.Success)
+}
@@ -5,23 +5,35 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"stock-investment-backend/connection"
+	"stock-investment-backend/service"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	router *mux.Router
+	router    *mux.Router
+	store     service.Store
+	profiles  service.ScoringProfiles
+	scheduler *service.Scheduler
 }
 
-func NewServer() *Server {
+func NewServer(store service.Store, profiles service.ScoringProfiles) *Server {
 	s := &Server{
-		router: mux.NewRouter(),
+		router:   mux.NewRouter(),
+		store:    store,
+		profiles: profiles,
 	}
 	s.setupRoutes()
 	return s
 }
 
+// SetScheduler reports the status of sched on /api/v1/admin/sync-status
+func (s *Server) SetScheduler(sched *service.Scheduler) {
+	s.scheduler = sched
+}
+
 func (s *Server) setupRoutes() {
 	//Health check
 	s.router.HandleFunc("/health", s.healthCheck).Methods("GET")
@@ -36,13 +48,39 @@ func (s *Server) setupRoutes() {
 	//Brokerages
 	api.HandleFunc("/brokerages", s.getBrokerages).Methods("GET")
 
+	//Search
+	api.HandleFunc("/search", s.search).Methods("GET")
+
 	//Recommendations
 	api.HandleFunc("/recommendations", s.getRecommendations).Methods("GET")
+	api.HandleFunc("/recommendations/export", s.exportRecommendations).Methods("GET")
 	api.HandleFunc("/recommendations/company/{ticker}", s.getRecommendationsByTicker).Methods("GET")
-	api.HandleFunc("/recommendations/brokerage/{brokerage}", s.getRecommendationsByBrokerage).Methods("GET")
+	api.HandleFunc("/recommendations/brokerage/{id}", s.getRecommendationsByBrokerage).Methods("GET")
+
+	//Scores
+	api.HandleFunc("/scores", s.getScores).Methods("GET")
+	api.HandleFunc("/scores/{ticker}", s.getScoreByTicker).Methods("GET")
+
+	//Rating normalization
+	api.HandleFunc("/ratings/mappings", s.getRatingMappings).Methods("GET")
+	api.HandleFunc("/ratings/mappings/{rating}", s.putRatingMapping).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/ratings/unmapped", s.getUnmappedRatings).Methods("GET")
+
+	//Administration
+	api.HandleFunc("/admin/ingest-runs", s.getIngestRuns).Methods("GET")
+	api.HandleFunc("/admin/sync-status", s.getSyncStatus).Methods("GET")
+	api.HandleFunc("/admin/schema-drift", s.getSchemaReports).Methods("GET")
+
+	//Unknown routes and methods answer with problems too
+	s.router.NotFoundHandler = requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, http.StatusNotFound, "no route for "+r.URL.Path)
+	}))
+	s.router.MethodNotAllowedHandler = requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	}))
 
 	// CORS Middleware
-	s.router.Use(corsMiddleware)
+	s.router.Use(requestIDMiddleware, corsMiddleware)
 }
 
 // CORS Middleware
@@ -50,7 +88,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -61,6 +100,11 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// ServeHTTP lets the server be mounted as an http.Handler, e.g. by httptest
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
 func (s *Server) Start(port string) {
 	fmt.Printf("🚀 Server starting on port %s\n", port)
 	log.Fatal(http.ListenAndServe(":"+port, s.router))
@@ -74,6 +118,9 @@ func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
 		"timestamp": time.Now().Format(time.RFC3339),
 		"service":   "stock-investment-backend",
 	}
+	if stats := connection.Stats(); stats != nil {
+		response["database_pool"] = stats
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
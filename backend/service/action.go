@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"stock-investment-backend/connection"
+	"strings"
+)
+
+// EventType is the structured kind of analyst action behind a recommendation
+type EventType string
+
+const (
+	EventUpgrade      EventType = "upgrade"
+	EventDowngrade    EventType = "downgrade"
+	EventInitiation   EventType = "initiation"
+	EventReiteration  EventType = "reiteration"
+	EventTargetRaise  EventType = "target_raise"
+	EventTargetCut    EventType = "target_cut"
+	EventCoverageDrop EventType = "coverage_drop"
+)
+
+// EventTypes lists every event type
+var EventTypes = []EventType{
+	EventUpgrade, EventDowngrade, EventInitiation, EventReiteration,
+	EventTargetRaise, EventTargetCut, EventCoverageDrop,
+}
+
+// ParseEventType validates an event type name
+func ParseEventType(value string) (EventType, error) {
+	for _, eventType := range EventTypes {
+		if string(eventType) == value {
+			return eventType, nil
+		}
+	}
+	names := make([]string, len(EventTypes))
+	for i, eventType := range EventTypes {
+		names[i] = string(eventType)
+	}
+	return "", newError(ErrInvalidInput, "unknown event type %q (expected one of %s)", value, strings.Join(names, ", "))
+}
+
+// actionRules are checked in order, the first rule with a matching keyword wins.
+// Rating changes come first so "upgraded by" is never read as a target change.
+var actionRules = []struct {
+	eventType EventType
+	keywords  []string
+}{
+	{EventDowngrade, []string{"downgrade"}},
+	{EventUpgrade, []string{"upgrade"}},
+	{EventCoverageDrop, []string{"dropped", "terminated", "suspended", "discontinued"}},
+	{EventInitiation, []string{"initiated", "resumed", "assumed"}},
+	{EventReiteration, []string{"reiterated", "maintained", "affirmed"}},
+	{EventTargetRaise, []string{"raised", "increased", "boosted"}},
+	{EventTargetCut, []string{"lowered", "cut", "reduced", "decreased"}},
+}
+
+// ClassifyAction maps an upstream action such as "target raised by" to its
+// event type, returning "" for actions no rule recognizes
+func ClassifyAction(action string) EventType {
+	action = strings.ToLower(action)
+	for _, rule := range actionRules {
+		for _, keyword := range rule.keywords {
+			if strings.Contains(action, keyword) {
+				return rule.eventType
+			}
+		}
+	}
+	return ""
+}
+
+// Classification is the structured form of a recommendation's action. The
+// directions are -1, 0 or 1, and nil when they cannot be told.
+type Classification struct {
+	EventType       EventType
+	RatingDirection *int
+	TargetDirection *int
+}
+
+// Classify derives the event type and the direction of the rating and the
+// target. Target direction comes from the prices when both are known.
+func (d RecommendationData) Classify() Classification {
+	c := Classification{EventType: ClassifyAction(d.Action)}
+
+	switch {
+	case c.EventType == EventUpgrade:
+		c.RatingDirection = direction(1)
+	case c.EventType == EventDowngrade:
+		c.RatingDirection = direction(-1)
+	case d.RatingFrom != "" && RatingKey(d.RatingFrom) == RatingKey(d.RatingTo):
+		c.RatingDirection = direction(0)
+	}
+
+	targets, _ := d.ParseTargets()
+	from, to := targets.From, targets.To
+	switch {
+	case from != nil && to != nil:
+		switch {
+		case *to > *from:
+			c.TargetDirection = direction(1)
+		case *to < *from:
+			c.TargetDirection = direction(-1)
+		default:
+			c.TargetDirection = direction(0)
+		}
+	case c.EventType == EventTargetRaise:
+		c.TargetDirection = direction(1)
+	case c.EventType == EventTargetCut:
+		c.TargetDirection = direction(-1)
+	}
+	return c
+}
+
+func direction(d int) *int {
+	return &d
+}
+
+// nullableEventType stores unclassified actions as NULL
+func nullableEventType(eventType EventType) interface{} {
+	if eventType == "" {
+		return nil
+	}
+	return string(eventType)
+}
+
+// ReclassifyActions recomputes the event type and directions of every stored
+// recommendation, e.g. after the classification rules changed
+func ReclassifyActions() (int, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	ctx := context.Background()
+	tx, err := conn.BeginConn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, action, COALESCE(rating_from, ''), COALESCE(rating_to, ''),
+			target_from::float8, target_to::float8
+		FROM analyst_recommendation
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("query failed: %w", err)
+	}
+
+	var ids []string
+	var eventTypes []*string
+	var ratingDirections, targetDirections []*int
+	for rows.Next() {
+		var id string
+		var data RecommendationData
+		var targetFrom, targetTo *float64
+		if err := rows.Scan(&id, &data.Action, &data.RatingFrom, &data.RatingTo, &targetFrom, &targetTo); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan failed: %w", err)
+		}
+		data.TargetFrom = formatTarget(targetFrom, "")
+		data.TargetTo = formatTarget(targetTo, "")
+
+		c := data.Classify()
+		var eventType *string
+		if c.EventType != "" {
+			name := string(c.EventType)
+			eventType = &name
+		}
+		ids = append(ids, id)
+		eventTypes = append(eventTypes, eventType)
+		ratingDirections = append(ratingDirections, c.RatingDirection)
+		targetDirections = append(targetDirections, c.TargetDirection)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("query failed: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE analyst_recommendation ar
+		SET event_type = c.event_type, rating_direction = c.rating_direction,
+			target_direction = c.target_direction, updated_at = now()
+		FROM unnest($1::uuid[], $2::text[], $3::smallint[], $4::smallint[])
+			AS c(id, event_type, rating_direction, target_direction)
+		WHERE ar.id = c.id
+		AND (ar.event_type, ar.rating_direction, ar.target_direction)
+			IS DISTINCT FROM (c.event_type, c.rating_direction, c.target_direction)`,
+		ids, eventTypes, ratingDirections, targetDirections)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update event types: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Reclassified %d recommendations", tag.RowsAffected())
+	return int(tag.RowsAffected()), nil
+}
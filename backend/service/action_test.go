@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyAction(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected EventType
+	}{
+		{action: "upgraded by", expected: EventUpgrade},
+		{action: "Downgraded by", expected: EventDowngrade},
+		{action: "initiated by", expected: EventInitiation},
+		{action: "coverage resumed by", expected: EventInitiation},
+		{action: "reiterated by", expected: EventReiteration},
+		{action: "target raised by", expected: EventTargetRaise},
+		{action: "target lowered by", expected: EventTargetCut},
+		{action: "coverage dropped by", expected: EventCoverageDrop},
+		{action: "", expected: ""},
+		{action: "mentioned by", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ClassifyAction(tt.action))
+		})
+	}
+}
+
+func TestRecommendationData_Classify(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     RecommendationData
+		expected Classification
+	}{
+		{
+			name:     "upgrade with a higher target",
+			data:     RecommendationData{Action: "upgraded by", RatingFrom: "Hold", RatingTo: "Buy", TargetFrom: "$100.00", TargetTo: "$120.00"},
+			expected: Classification{EventType: EventUpgrade, RatingDirection: intPtr(1), TargetDirection: intPtr(1)},
+		},
+		{
+			name:     "target cut keeping the rating",
+			data:     RecommendationData{Action: "target lowered by", RatingFrom: "Buy", RatingTo: "buy", TargetFrom: "$50.00", TargetTo: "$40.00"},
+			expected: Classification{EventType: EventTargetCut, RatingDirection: intPtr(0), TargetDirection: intPtr(-1)},
+		},
+		{
+			name:     "target raise without prices",
+			data:     RecommendationData{Action: "target raised by"},
+			expected: Classification{EventType: EventTargetRaise, TargetDirection: intPtr(1)},
+		},
+		{
+			name:     "initiation has no previous rating",
+			data:     RecommendationData{Action: "initiated by", RatingTo: "Buy", TargetTo: "$80.00"},
+			expected: Classification{EventType: EventInitiation},
+		},
+		{
+			name:     "unknown action",
+			data:     RecommendationData{Action: "mentioned by", RatingFrom: "Hold", RatingTo: "Hold"},
+			expected: Classification{RatingDirection: intPtr(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.data.Classify())
+		})
+	}
+}
+
+func TestParseEventType(t *testing.T) {
+	eventType, err := ParseEventType("target_cut")
+	require.NoError(t, err)
+	assert.Equal(t, EventTargetCut, eventType)
+
+	_, err = ParseEventType("upgraded by")
+	assert.Error(t, err)
+}
+
+func TestMemoryStore_FiltersByEventType(t *testing.T) {
+	store := NewMemoryStore()
+	raise := baseRecommendationData()
+	downgrade := baseRecommendationData()
+	downgrade.Action = "downgraded by"
+	downgrade.Brokerage = "Morgan Stanley"
+	_, err := store.UpsertRecommendations(context.Background(), []RecommendationData{raise, downgrade}, SaveOptions{})
+	require.NoError(t, err)
+
+	recs, total, err := store.ListRecommendations(context.Background(), RecommendationFilter{EventType: EventDowngrade})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, recs, 1)
+	assert.Equal(t, EventDowngrade, recs[0].EventType)
+	assert.Equal(t, intPtr(-1), recs[0].RatingDirection)
+}
@@ -1,133 +1,312 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
-	"os"
 	"time"
+)
+
+// FetchOptions configures a -fetch run
+type FetchOptions struct {
+	// Source is the registered source to sync, DefaultSourceName when empty
+	Source string
+	// Incremental resumes from the stored checkpoint and stops paging
+	// once it reaches recommendations that were already stored
+	Incremental bool
+	Save        SaveOptions
+	Retry       RetryPolicy
+	// Drift is how the sync reacts to payloads that do not match the expected schema, warn by default
+	Drift DriftMode
+}
+
+// Validate rejects options a sync cannot honor together
+func (o FetchOptions) Validate() error {
+	//An incremental sync commits and checkpoints every page to resume from it
+	if o.Incremental && o.Save.Mode == SaveAtomic {
+		return newError(ErrInvalidInput, "incremental syncs save every page on its own, they cannot use the %s save mode", SaveAtomic)
+	}
+	return nil
+}
+
+// SyncStatus is the final outcome of a sync run
+type SyncStatus string
 
-	"github.com/joho/godotenv"
+const (
+	// SyncRunning means the run has not finished, or died before recording its outcome
+	SyncRunning SyncStatus = "running"
+	// SyncComplete means every page was fetched and saved
+	SyncComplete SyncStatus = "complete"
+	// SyncPartial means the run stopped early but some data was saved
+	SyncPartial SyncStatus = "partial"
+	// SyncFailed means nothing could be saved
+	SyncFailed SyncStatus = "failed"
+	// SyncSkipped means the run did not start because another sync held the lock
+	SyncSkipped SyncStatus = "skipped"
 )
 
-type ApiResponse struct {
-	Items    []map[string]interface{} `json:"items"`
-	NextPage string                   `json:"next_page,omitempty"`
+// SyncResult summarizes a sync run
+type SyncResult struct {
+	Status SyncStatus
+	Pages  int
+	Items  int
+	// Skipped counts items an incremental run found already stored
+	Skipped int
+	// Rejected counts items that could not be converted
+	Rejected int
+	Saved    SaveResult
+	Err      error
+}
+
+func (r SyncResult) String() string {
+	summary := fmt.Sprintf("%s: %d pages, %d items, %d rejected (%s)", r.Status, r.Pages, r.Items, r.Rejected, r.Saved)
+	if r.Err != nil {
+		summary += fmt.Sprintf(", error: %v", r.Err)
+	}
+	return summary
+}
+
+// finish derives the status from whether the run ended with an error and saved anything
+func (r *SyncResult) finish(err error) {
+	r.Err = err
+	switch {
+	case err == nil:
+		r.Status = SyncComplete
+	case r.Saved.Inserted+r.Saved.Updated+r.Saved.Unchanged > 0:
+		r.Status = SyncPartial
+	default:
+		r.Status = SyncFailed
+	}
+}
+
+// notStarted is the result of a sync that could not take the sync lock
+func notStarted(err error) SyncResult {
+	var result SyncResult
+	result.finish(err)
+	if errors.Is(err, ErrSyncLocked) {
+		result.Status = SyncSkipped
+	}
+	return result
 }
 
-// ApiGet fetches data from the API and saves it to the database
-func ApiGet() {
-	err := godotenv.Load()
+// ApiGet fetches data from the configured source and saves it to the database
+func ApiGet(opts FetchOptions) SyncResult {
+	if opts.Source == "" {
+		opts.Source = DefaultSourceName
+	}
+	src, err := NewSource(opts.Source, opts.Retry)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		var result SyncResult
+		result.finish(err)
+		startIngestRun(IngestFetch, opts.Source).finish(result)
+		return result
 	}
-	api_url := os.Getenv("API_URL")
-	bearer_token := "Bearer " + os.Getenv("BEARER_TOKEN")
+	return Sync(src, opts)
+}
 
-	var allItems []map[string]interface{}
-	nextPage := ""
+// syncStateName identifies the checkpoint of a source in the sync_state table
+func syncStateName(src Source) string {
+	return src.Name() + "_recommendations"
+}
 
-	for {
-		request_url := api_url
+// Sync pages through src and saves every recommendation it yields. The run is
+// recorded in ingest_run, its pages in raw_page and rejected items in
+// ingest_dead_letter.
+func Sync(src Source, opts FetchOptions) SyncResult {
+	return runSync(src, opts, IngestFetch)
+}
 
-		if nextPage != "" {
-			parsedUrl, err := url.Parse(api_url)
-			if err != nil {
-				log.Fatal("Error parsing URL")
-			}
-			query := parsedUrl.Query()
-			query.Set("next_page", nextPage)
-			parsedUrl.RawQuery = query.Encode()
-			request_url = parsedUrl.String()
-		}
+// archiveFunc stores a fetched page, see ingestRecorder.archivePage
+type archiveFunc func(number int, token string, page *SourcePage)
 
-		req, err := http.NewRequest("GET", request_url, nil)
-		if err != nil {
-			log.Fatal("Error creating request")
-		}
-		req.Header.Add("Authorization", bearer_token)
+// runSync records a sync of the given kind. Only fetches archive their pages,
+// and replays are never incremental so they leave the sync checkpoint alone.
+func runSync(src Source, opts FetchOptions, kind IngestKind) SyncResult {
+	if err := opts.Validate(); err != nil {
+		return notStarted(err)
+	}
+	unlock, err := lockSync()
+	if err != nil {
+		return notStarted(err)
+	}
+	defer unlock()
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Println("Error sending request")
-			break
-		}
-		defer resp.Body.Close()
+	run := startIngestRun(kind, src.Name())
+	opts.Save.OnBatchError = run.deadLetterBatch
+	if opts.Drift == "" {
+		opts.Drift = DriftWarn
+	}
+	drift := newDriftCheck(opts.Drift, src.Name())
+
+	archive := archiveFunc(func(int, string, *SourcePage) {})
+	if kind == IngestFetch {
+		archive = run.archivePage
+	}
+
+	var result SyncResult
+	if opts.Incremental && kind == IngestFetch {
+		result = syncIncremental(src, opts.Save, run, archive, drift)
+	} else {
+		result = syncAll(src, opts.Save, run, archive, drift)
+	}
+	drift.record(run)
+	run.finish(result)
+	return result
+}
+
+// syncAll converts and saves every page of src as it arrives, while the next
+// pages are being fetched. In SaveAtomic mode a fetch error or schema drift
+// rolls back the pages saved before it.
+func syncAll(src Source, saveOpts SaveOptions, run *ingestRecorder, archive archiveFunc, drift *driftCheck) SyncResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Error: Status code %d", resp.StatusCode)
+	var result SyncResult
+	var fetchErr, saveErr error
+	writer := newRecommendationWriter(saveOpts)
+	kept := "the pages retrieved so far are kept"
+	if saveOpts.Mode == SaveAtomic {
+		kept = "nothing is saved"
+	}
+
+	for fetched := range fetchPages(ctx, src, "") {
+		if fetched.err != nil {
+			log.Printf("❌ %v", fetched.err)
+			fmt.Printf("⚠️  Fetching stopped early after %d pages, %s\n", result.Pages, kept)
+			fetchErr = fetched.err
 			break
 		}
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Println("Error reading response body")
+		result.Pages++
+		result.Items += len(fetched.page.Items)
+		archive(result.Pages, fetched.token, fetched.page)
+		if err := drift.page(fetched.page.Items); err != nil {
+			log.Printf("❌ %v", err)
+			fmt.Printf("⚠️  Sync stopped at page %d, %s; the page is archived for -replay once the converter is fixed\n", result.Pages, kept)
+			fetchErr = err
 			break
 		}
 
-		var apiResponse ApiResponse
-		err = json.Unmarshal(body, &apiResponse)
+		recommendations := convertPage(src, fetched.page, run, &result)
+		saved, err := writer.save(ctx, recommendations)
 		if err != nil {
-			log.Println("Error unmarshalling response body")
+			log.Printf("❌ Error saving recommendations: %v", err)
+			saveErr = err
 			break
 		}
+		fmt.Printf("💾 Page %d: %d items (%s)\n", result.Pages, len(fetched.page.Items), saved)
+	}
+	cancel()
 
-		allItems = append(allItems, apiResponse.Items...)
+	saved, err := writer.finish(context.Background(), errors.Join(fetchErr, saveErr))
+	result.Saved = saved
+	if saveErr == nil {
+		saveErr = err
+	}
+	if saveErr != nil {
+		result.finish(saveErr)
+		return result
+	}
+	if fetchErr == nil {
+		fmt.Printf("✅ Sync complete! %s\n", result.Saved)
+	}
 
-		if apiResponse.NextPage == "" {
-			break
-		}
-		nextPage = apiResponse.NextPage
+	result.finish(fetchErr)
+	return result
+}
+
+// syncIncremental pages through src persisting and checkpointing every page
+// as it arrives, so an interrupted run resumes from its last checkpoint.
+func syncIncremental(src Source, saveOpts SaveOptions, run *ingestRecorder, archive archiveFunc, drift *driftCheck) SyncResult {
+	var result SyncResult
+
+	//No connection is held across pages: saving, archiving and dead lettering
+	//take their own, and a small pool would otherwise run out
+	ctx := context.Background()
+	state, err := loadSyncState(ctx, syncStateName(src))
+	if err != nil {
+		result.finish(err)
+		return result
+	}
 
-		fmt.Printf("Retrieved %d items, fetching next page: %s\n", len(apiResponse.Items), nextPage)
+	if state.InProgress() {
+		fmt.Printf("⏯️  Resuming interrupted sync from page token: %s\n", state.NextPage)
+	}
+	if state.LastTime != nil {
+		fmt.Printf("🕒 Fetching recommendations newer than %s\n", state.LastTime.Format(time.RFC3339))
+	}
+
+	interrupted := func(err error) SyncResult {
+		log.Printf("❌ %v", err)
+		log.Println("⚠️  Sync interrupted, it will resume from the last checkpoint on the next run")
+		result.finish(err)
+		return result
 	}
-	fmt.Printf("🔄 Starting data processing with %d total items...\n", len(allItems))
 
-	recommendations := make([]RecommendationData, 0, len(allItems))
+	//Validate keeps incremental syncs out of SaveAtomic mode, every page is
+	//committed by save and the writer has nothing left to finish
+	writer := newRecommendationWriter(saveOpts)
 
-	fmt.Println("🔄 Converting API data to RecommendationData structs...")
-	//Transform API data to RecommendationData structs
-	for i, item := range allItems {
-		if i%100 == 0 { // Progress every 100 items
-			fmt.Printf("�� Processing item %d/%d\n", i, len(allItems))
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for fetched := range fetchPages(fetchCtx, src, state.NextPage) {
+		if fetched.err != nil {
+			return interrupted(fetched.err)
+		}
+		page := fetched.page
+		result.Pages++
+		result.Items += len(page.Items)
+		archive(result.Pages, fetched.token, page)
+		if err := drift.page(page.Items); err != nil {
+			return interrupted(err)
 		}
 
-		rec, err := convertRecommendationData(item)
-		if err != nil {
-			log.Printf("Error converting recommendation data %d: %v", i, err)
-			continue
+		recommendations := convertPage(src, page, run, &result)
+		fresh := recommendations[:0]
+		reachedStored := false
+		for _, rec := range recommendations {
+			//Items at or before the watermark were stored by a previous run
+			if state.LastTime != nil && !rec.Time.After(*state.LastTime) {
+				reachedStored = true
+				result.Skipped++
+				continue
+			}
+			fresh = append(fresh, rec)
 		}
-		recommendations = append(recommendations, rec)
-	}
+		recommendations = fresh
 
-	fmt.Printf("✅ Conversion complete! %d recommendations ready for database\n", len(recommendations))
+		if len(recommendations) > 0 {
+			saved, err := writer.save(ctx, recommendations)
+			if err != nil {
+				return interrupted(fmt.Errorf("error saving recommendations: %w", err))
+			}
+			for _, rec := range recommendations {
+				state.Observe(rec.Time)
+			}
+			result.Saved.Add(saved)
+		}
 
-	fmt.Println("💾 Starting database insertion...")
-	//Store to database
-	err = SaveRecommendations(recommendations)
-	if err != nil {
-		log.Printf("❌ Error saving recommendations: %v", err)
-	} else {
-		fmt.Printf("✅ Database insertion complete! %d recommendations saved\n", len(recommendations))
-	}
+		if reachedStored || page.NextPage == "" {
+			state.Complete()
+			if err := saveSyncState(ctx, state); err != nil {
+				return interrupted(err)
+			}
+			break
+		}
 
-	fmt.Println("📄 Generating final JSON response...")
-	//Log JSON response
-	finalReponse := map[string]interface{}{
-		"total_items": len(allItems),
-		"items":       allItems,
-	}
-	finalJSON, err := json.MarshalIndent(finalReponse, "", "  ")
-	if err != nil {
-		log.Println("❌ Error marshalling final response")
-	} else {
-		fmt.Println("✅ JSON response generated successfully")
+		//Checkpoint the next page only after the current one is persisted
+		state.NextPage = page.NextPage
+		if err := saveSyncState(ctx, state); err != nil {
+			return interrupted(err)
+		}
+
+		fmt.Printf("Saved %d items, checkpoint at page: %s\n", len(recommendations), state.NextPage)
 	}
-	fmt.Println(string(finalJSON))
+
+	fmt.Printf("✅ Incremental sync complete! %s\n", result.Saved)
+	result.finish(nil)
+	return result
 }
 
 func convertRecommendationData(item map[string]interface{}) (RecommendationData, error) {
@@ -157,7 +336,7 @@ func convertRecommendationData(item map[string]interface{}) (RecommendationData,
 	if timeStr != "" {
 		parsedTime, err := time.Parse(time.RFC3339, timeStr)
 		if err != nil {
-			return rec, fmt.Errorf("failed to parse time: %v", err)
+			return rec, fmt.Errorf("failed to parse time: %w", err)
 		}
 		rec.Time = parsedTime
 	} else {
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// SaveMode selects how failures are isolated while saving recommendations
+type SaveMode string
+
+const (
+	// SaveAtomic saves everything in one transaction, any failure rolls back the whole load
+	SaveAtomic SaveMode = "atomic"
+	// SaveBatch wraps every batch in a savepoint so a failing batch is skipped and the rest is kept
+	SaveBatch SaveMode = "batch"
+)
+
+const DefaultBatchSize = 1000
+
+// SaveOptions configures SaveRecommendations
+type SaveOptions struct {
+	Mode      SaveMode
+	BatchSize int
+	// OnBatchError, when set, receives the recommendations that failed to save
+	// with the error, the whole load in SaveAtomic mode
+	OnBatchError func(batch []RecommendationData, err error)
+}
+
+// ParseSaveMode validates a save mode given on the command line
+func ParseSaveMode(mode string) (SaveMode, error) {
+	switch SaveMode(strings.ToLower(mode)) {
+	case SaveAtomic:
+		return SaveAtomic, nil
+	case SaveBatch:
+		return SaveBatch, nil
+	}
+	return "", fmt.Errorf("unknown save mode %q (expected %q or %q)", mode, SaveAtomic, SaveBatch)
+}
+
+// stagingColumns are the columns streamed with COPY into the staging table
+var stagingColumns = []string{
+	"company_id", "brokerage_id", "target_from", "target_to",
+	"rating_from", "rating_to", "action", "time", "fingerprint", "source",
+	"event_type", "rating_direction", "target_direction", "currency",
+}
+
+// saveBatch loads recommendations inside tx: companies and brokerages are
+// resolved in bulk, rows are streamed with COPY into a staging table and
+// merged into analyst_recommendation with a single upsert.
+func saveBatch(tx pgx.Tx, ctx context.Context, recommendations []RecommendationData) (SaveResult, error) {
+	var result SaveResult
+
+	//Rows repeated within the batch would hit the same row twice in the merge
+	unique := make([]RecommendationData, 0, len(recommendations))
+	fingerprints := make([]string, 0, len(recommendations))
+	seen := make(map[string]bool, len(recommendations))
+	for _, rec := range recommendations {
+		fingerprint := rec.Fingerprint()
+		key := rec.sourceName() + "/" + fingerprint
+		if seen[key] {
+			result.Unchanged++
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, rec)
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	if len(unique) == 0 {
+		return result, nil
+	}
+
+	companyIDs, err := resolveCompanies(tx, ctx, unique)
+	if err != nil {
+		return result, err
+	}
+	brokerageIDs, err := resolveBrokerages(tx, ctx, unique)
+	if err != nil {
+		return result, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS recommendation_staging
+		(LIKE analyst_recommendation INCLUDING DEFAULTS) ON COMMIT DROP
+	`)
+	if err != nil {
+		return result, fmt.Errorf("failed to create staging table: %w", err)
+	}
+	_, err = tx.Exec(ctx, "TRUNCATE recommendation_staging")
+	if err != nil {
+		return result, fmt.Errorf("failed to truncate staging table: %w", err)
+	}
+
+	rows := make([][]interface{}, 0, len(unique))
+	var ingestErrors []IngestError
+	for i, rec := range unique {
+		var brokerageID interface{}
+		if id, ok := brokerageIDs[rec.Brokerage]; ok {
+			brokerageID = id
+		}
+		targets, errs := rec.ParseTargets()
+		ingestErrors = append(ingestErrors, errs...)
+		var currency interface{}
+		if targets.Currency != "" {
+			currency = targets.Currency
+		}
+		classification := rec.Classify()
+		rows = append(rows, []interface{}{
+			companyIDs[normalizeTicker(rec.Ticker)], brokerageID, targets.From, targets.To,
+			rec.RatingFrom, rec.RatingTo, rec.Action, rec.Time, fingerprints[i], rec.sourceName(),
+			nullableEventType(classification.EventType), classification.RatingDirection, classification.TargetDirection,
+			currency,
+		})
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"recommendation_staging"}, stagingColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return result, fmt.Errorf("failed to copy recommendations to staging: %w", err)
+	}
+
+	//Merge staging into the main table normalizing ratings, unchanged rows are not returned
+	merged, err := tx.Query(ctx, `
+		INSERT INTO analyst_recommendation
+		(company_id, brokerage_id, target_from, target_to, rating_from, rating_to,
+			rating_from_score, rating_to_score, action, time, fingerprint, source,
+			event_type, rating_direction, target_direction, currency)
+		SELECT s.company_id, s.brokerage_id, s.target_from, s.target_to, s.rating_from, s.rating_to,
+			rf.score, rt.score, s.action, s.time, s.fingerprint, s.source,
+			s.event_type, s.rating_direction, s.target_direction, s.currency
+		FROM recommendation_staging s
+		LEFT JOIN rating_mapping rf ON rf.rating_key = rating_key(s.rating_from)
+		LEFT JOIN rating_mapping rt ON rt.rating_key = rating_key(s.rating_to)
+		ON CONFLICT (source, fingerprint) DO UPDATE SET
+		company_id = EXCLUDED.company_id, brokerage_id = EXCLUDED.brokerage_id,
+		target_from = EXCLUDED.target_from, target_to = EXCLUDED.target_to,
+		rating_from = EXCLUDED.rating_from, rating_to = EXCLUDED.rating_to,
+		rating_from_score = EXCLUDED.rating_from_score, rating_to_score = EXCLUDED.rating_to_score,
+		action = EXCLUDED.action, time = EXCLUDED.time, event_type = EXCLUDED.event_type,
+		rating_direction = EXCLUDED.rating_direction, target_direction = EXCLUDED.target_direction,
+		currency = EXCLUDED.currency, updated_at = now()
+		WHERE (analyst_recommendation.company_id, analyst_recommendation.brokerage_id,
+			analyst_recommendation.target_from, analyst_recommendation.target_to,
+			analyst_recommendation.rating_from, analyst_recommendation.rating_to,
+			analyst_recommendation.rating_from_score, analyst_recommendation.rating_to_score,
+			analyst_recommendation.action, analyst_recommendation.time,
+			analyst_recommendation.event_type, analyst_recommendation.rating_direction,
+			analyst_recommendation.target_direction, analyst_recommendation.currency)
+		IS DISTINCT FROM (EXCLUDED.company_id, EXCLUDED.brokerage_id,
+			EXCLUDED.target_from, EXCLUDED.target_to,
+			EXCLUDED.rating_from, EXCLUDED.rating_to,
+			EXCLUDED.rating_from_score, EXCLUDED.rating_to_score,
+			EXCLUDED.action, EXCLUDED.time, EXCLUDED.event_type,
+			EXCLUDED.rating_direction, EXCLUDED.target_direction, EXCLUDED.currency)
+		RETURNING source, fingerprint, (xmax = 0)
+	`)
+	if err != nil {
+		return result, fmt.Errorf("failed to merge staged recommendations: %w", err)
+	}
+	defer merged.Close()
+
+	changed := make(map[string]bool)
+	for merged.Next() {
+		var source, fingerprint string
+		var inserted bool
+		if err := merged.Scan(&source, &fingerprint, &inserted); err != nil {
+			return result, fmt.Errorf("scan failed: %w", err)
+		}
+		if inserted {
+			result.Inserted++
+		} else {
+			result.Updated++
+		}
+		changed[source+"/"+fingerprint] = true
+	}
+	if err := merged.Err(); err != nil {
+		return result, fmt.Errorf("failed to merge staged recommendations: %w", err)
+	}
+	result.Unchanged += len(unique) - len(changed)
+	merged.Close()
+
+	//The errors of unchanged rows were recorded when they were first saved
+	changedErrors := ingestErrors[:0]
+	for _, e := range ingestErrors {
+		if changed[e.Source+"/"+e.Fingerprint] {
+			changedErrors = append(changedErrors, e)
+		}
+	}
+	if err := saveIngestErrors(tx, ctx, changedErrors); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// saveIngestErrors records the fields of the batch that could not be parsed
+func saveIngestErrors(tx pgx.Tx, ctx context.Context, ingestErrors []IngestError) error {
+	if len(ingestErrors) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, len(ingestErrors))
+	for i, e := range ingestErrors {
+		rows[i] = []interface{}{e.Source, e.Fingerprint, e.Ticker, e.Field, e.RawValue, e.Error}
+	}
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"ingest_error"},
+		[]string{"source", "fingerprint", "ticker", "field", "raw_value", "error"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("failed to save ingest errors: %w", err)
+	}
+	log.Printf("⚠️  %d target prices could not be parsed, see the ingest_error table", len(ingestErrors))
+	return nil
+}
+
+// resolveCompanies creates missing companies, renames the ones the batch names
+// differently and returns the id of every normalized ticker in the batch
+func resolveCompanies(tx pgx.Tx, ctx context.Context, recommendations []RecommendationData) (map[string]string, error) {
+	//The last name given to a ticker wins, recommendations without one keep the stored name
+	names := make(map[string]string)
+	for _, rec := range recommendations {
+		ticker := normalizeTicker(rec.Ticker)
+		if _, ok := names[ticker]; !ok || rec.Company != "" {
+			names[ticker] = rec.Company
+		}
+	}
+	tickers := make([]string, 0, len(names))
+	companyNames := make([]string, 0, len(names))
+	for ticker, name := range names {
+		tickers = append(tickers, ticker)
+		companyNames = append(companyNames, name)
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO company (ticker, name)
+		SELECT * FROM unnest($1::text[], $2::text[])
+		ON CONFLICT (ticker) DO UPDATE SET
+		name = EXCLUDED.name, updated_at = now()
+		WHERE EXCLUDED.name <> '' AND company.name IS DISTINCT FROM EXCLUDED.name`,
+		tickers, companyNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert companies: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, "SELECT ticker, id FROM company WHERE ticker = ANY($1)", tickers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query companies: %w", err)
+	}
+	return scanIDMap(rows)
+}
+
+// resolveBrokerages creates missing brokerages and returns the id of every named brokerage in the batch
+func resolveBrokerages(tx pgx.Tx, ctx context.Context, recommendations []RecommendationData) (map[string]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, rec := range recommendations {
+		if rec.Brokerage == "" || seen[rec.Brokerage] {
+			continue
+		}
+		seen[rec.Brokerage] = true
+		names = append(names, rec.Brokerage)
+	}
+	if len(names) == 0 {
+		return map[string]string{}, nil
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO brokerage (name)
+		SELECT * FROM unnest($1::text[])
+		ON CONFLICT (name) DO NOTHING`,
+		names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert brokerages: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, "SELECT name, id FROM brokerage WHERE name = ANY($1)", names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query brokerages: %w", err)
+	}
+	return scanIDMap(rows)
+}
+
+// scanIDMap reads (key, id) rows into a map
+func scanIDMap(rows pgx.Rows) (map[string]string, error) {
+	defer rows.Close()
+
+	ids := make(map[string]string)
+	for rows.Next() {
+		var key, id string
+		if err := rows.Scan(&key, &id); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		ids[key] = id
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursor tokens that were not issued by NewCursor
+var ErrInvalidCursor = newError(ErrInvalidInput, "invalid cursor")
+
+// Cursor is a position between two recommendations of a listing sorted by
+// time. Unlike offsets, cursors keep pointing at the same rows while new
+// recommendations are ingested.
+type Cursor struct {
+	Time time.Time
+	ID   string
+	// Before selects the page ending at the position, instead of the page starting after it
+	Before bool
+}
+
+// cursorToken is the JSON inside the opaque token
+type cursorToken struct {
+	Time   time.Time `json:"t"`
+	ID     string    `json:"id"`
+	Before bool      `json:"b,omitempty"`
+}
+
+// NewCursor returns the position right after r, or right before it when before is set
+func NewCursor(r Recommendation, before bool) Cursor {
+	return Cursor{Time: r.Time, ID: r.ID, Before: before}
+}
+
+// Encode returns the opaque token of the cursor
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(cursorToken{Time: c.Time, ID: c.ID, Before: c.Before})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token returned by Encode
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var t cursorToken
+	if err := json.Unmarshal(data, &t); err != nil || !isUUID(t.ID) || t.Time.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{Time: t.Time, ID: t.ID, Before: t.Before}, nil
+}
+
+// CursorSort reports whether keys can be paged with a cursor, which needs a
+// listing sorted by time only, and whether it is newest first
+func CursorSort(keys []SortKey) (desc bool, ok bool) {
+	switch {
+	case len(keys) == 0:
+		return true, true
+	case len(keys) == 1 && keys[0].Field == "time":
+		return keys[0].Desc, true
+	}
+	return false, false
+}
+
+// cursorQuery is the keyset condition of cursor on a listing sorted by time,
+// and whether the rows must be read in reverse order
+func cursorQuery(cursor *Cursor, desc bool) (op string, reverse bool) {
+	//The page holds smaller (time, id) pairs when it comes after the position
+	//in a newest first listing, or before it in an oldest first one
+	if desc != cursor.Before {
+		op = "<"
+	} else {
+		op = ">"
+	}
+	return op, cursor.Before
+}
+
+// checkCursor rejects filters that cannot be paged with their cursor
+func checkCursor(filter RecommendationFilter) (desc bool, err error) {
+	desc, ok := CursorSort(filter.Sort)
+	if filter.Cursor == nil {
+		return desc, nil
+	}
+	if !ok {
+		return desc, newError(ErrInvalidInput, "cursors only page listings sorted by time")
+	}
+	if filter.Offset > 0 {
+		return desc, newError(ErrInvalidInput, "cursor and offset cannot be combined")
+	}
+	return desc, nil
+}
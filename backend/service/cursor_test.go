@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor_RoundTrips(t *testing.T) {
+	cursor := Cursor{Time: time.Date(2025, 1, 10, 0, 30, 0, 123, time.UTC), ID: "8b5f3c2e-0d4a-4e55-9f0e-3c1d2a4b5c6d", Before: true}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	//Well formed, but the id would fail the ::uuid cast of the keyset query
+	forged := Cursor{Time: cursor.Time, ID: "42'; DROP TABLE company"}.Encode()
+
+	for _, token := range []string{"", "not base64!", "e30", cursor.Encode()[:10], forged} {
+		_, err := DecodeCursor(token)
+		assert.True(t, errors.Is(err, ErrInvalidCursor), token)
+	}
+}
+
+func TestCursorQuery(t *testing.T) {
+	tests := []struct {
+		desc, before bool
+		op           string
+	}{
+		{true, false, "<"},
+		{true, true, ">"},
+		{false, false, ">"},
+		{false, true, "<"},
+	}
+	for _, tt := range tests {
+		op, reverse := cursorQuery(&Cursor{Before: tt.before}, tt.desc)
+		assert.Equal(t, tt.op, op)
+		assert.Equal(t, tt.before, reverse)
+	}
+}
+
+func TestMemoryStore_CursorPagination(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	//Pairs of recommendations share a time, so pages split ties by id
+	var batch []RecommendationData
+	for i := 0; i < 7; i++ {
+		data := baseRecommendationData()
+		data.Ticker = fmt.Sprintf("T%d", i)
+		data.Time = start.Add(time.Duration(i/2) * time.Hour)
+		batch = append(batch, data)
+	}
+	_, err := store.UpsertRecommendations(ctx, batch, SaveOptions{})
+	require.NoError(t, err)
+
+	for _, desc := range []bool{true, false} {
+		t.Run(fmt.Sprintf("desc=%v", desc), func(t *testing.T) {
+			sort := []SortKey{{Field: "time", Desc: desc}}
+			all, _, err := store.ListRecommendations(ctx, RecommendationFilter{Sort: sort})
+			require.NoError(t, err)
+
+			//Forward through every page, then backwards from the last row
+			var seen []Recommendation
+			var cursor *Cursor
+			for {
+				page, total, err := store.ListRecommendations(ctx, RecommendationFilter{Sort: sort, Cursor: cursor, Limit: 3, SkipCount: true})
+				require.NoError(t, err)
+				assert.Equal(t, -1, total)
+				if len(page) == 0 {
+					break
+				}
+				seen = append(seen, page...)
+				next := NewCursor(page[len(page)-1], false)
+				cursor = &next
+			}
+			assert.Equal(t, all, seen)
+
+			before := NewCursor(all[len(all)-1], true)
+			page, _, err := store.ListRecommendations(ctx, RecommendationFilter{Sort: sort, Cursor: &before, Limit: 3})
+			require.NoError(t, err)
+			assert.Equal(t, all[len(all)-4:len(all)-1], page)
+		})
+	}
+
+	_, _, err = store.ListRecommendations(ctx, RecommendationFilter{Sort: []SortKey{{Field: "ticker"}}, Cursor: &Cursor{}})
+	assert.Error(t, err)
+	_, _, err = store.ListRecommendations(ctx, RecommendationFilter{Cursor: &Cursor{}, Offset: 2})
+	assert.Error(t, err)
+}
@@ -2,9 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"stock-investment-backend/connection"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 type Company struct {
@@ -28,30 +33,48 @@ type Recommendation struct {
 	Brokerage  *Brokerage `json:"brokerage,omitempty"`
 	TargetFrom *float64   `json:"target_from"`
 	TargetTo   *float64   `json:"target_to"`
+	Currency   string     `json:"currency"`
 	RatingFrom string     `json:"rating_from"`
 	RatingTo   string     `json:"rating_to"`
-	Action     string     `json:"action"`
-	Time       time.Time  `json:"time"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	// Ratings on the canonical 1 (Strong Sell) to 5 (Strong Buy) scale, nil when unmapped
+	RatingFromScore *int      `json:"rating_from_score"`
+	RatingToScore   *int      `json:"rating_to_score"`
+	Action          string    `json:"action"`
+	EventType       EventType `json:"event_type"`
+	// Directions of the rating and target change: -1, 0 or 1, nil when unknown
+	RatingDirection *int      `json:"rating_direction"`
+	TargetDirection *int      `json:"target_direction"`
+	Time            time.Time `json:"time"`
+	Source          string    `json:"source"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PostgresStore implements Store on top of the shared database connection pool
+type PostgresStore struct{}
+
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
 }
 
 // Retrieve all companies
-func GetAllCompanies() ([]Company, error) {
+func (s *PostgresStore) ListCompanies(ctx context.Context, sort []SortKey) ([]Company, error) {
+	order, err := orderBy(sort, defaultCompanySort, companySortColumns, "id")
+	if err != nil {
+		return nil, err
+	}
+
 	conn, err := connection.GetDatabaseConnection()
 	if err != nil {
-		return nil, fmt.Errorf("database connection failed: %v", err)
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
 	}
 	defer conn.CloseConn(context.Background())
 
-	ctx := context.Background()
 	rows, err := conn.Query(ctx, `
 		SELECT id, ticker, name, created_at, updated_at
-		FROM company
-		ORDER BY ticker ASC
-	`)
+		FROM company`+order)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %v", err)
+		return nil, dbError("query failed", err)
 	}
 	defer rows.Close()
 
@@ -61,7 +84,7 @@ func GetAllCompanies() ([]Company, error) {
 		//scan assigns values from each column in the row to the corresponding struct fields
 		err := rows.Scan(&c.ID, &c.Ticker, &c.Name, &c.CreatedAt, &c.UpdatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("scan failed: %v", err)
+			return nil, dbError("scan failed", err)
 		}
 		companies = append(companies, c)
 	}
@@ -70,42 +93,42 @@ func GetAllCompanies() ([]Company, error) {
 }
 
 // Get company by ticker
-func GetCompanyByTicker(ticker string) (*Company, error) {
+func (s *PostgresStore) GetCompanyByTicker(ctx context.Context, ticker string) (*Company, error) {
 	conn, err := connection.GetDatabaseConnection()
 	if err != nil {
-		return nil, fmt.Errorf("database connection failed: %v", err)
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
 	}
 	defer conn.CloseConn(context.Background())
 
-	ctx := context.Background()
 	var c Company
 	err = conn.QueryRow(ctx, `
 		SELECT id, ticker, name, created_at, updated_at
 		FROM company
 		WHERE ticker = $1`,
 		ticker).Scan(&c.ID, &c.Ticker, &c.Name, &c.CreatedAt, &c.UpdatedAt)
-	if err != nil {
-		return nil, fmt.Errorf("company not found: %v", err)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("company %s: %w", ticker, ErrNotFound)
+	} else if err != nil {
+		return nil, dbError("company query failed", err)
 	}
 	return &c, nil
 }
 
 // Retrieve all brokerages
-func GetAllBrokerages() ([]Brokerage, error) {
+func (s *PostgresStore) ListBrokerages(ctx context.Context) ([]Brokerage, error) {
 	conn, err := connection.GetDatabaseConnection()
 	if err != nil {
-		return nil, fmt.Errorf("database connection failed: %v", err)
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
 	}
 	defer conn.CloseConn(context.Background())
 
-	ctx := context.Background()
 	rows, err := conn.Query(ctx, `
 		SELECT id, name, created_at, updated_at
 		FROM brokerage
 		ORDER BY name ASC
 	`)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %v", err)
+		return nil, dbError("query failed", err)
 	}
 	defer rows.Close()
 
@@ -114,7 +137,7 @@ func GetAllBrokerages() ([]Brokerage, error) {
 		var b Brokerage
 		err := rows.Scan(&b.ID, &b.Name, &b.CreatedAt, &b.UpdatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("scan failed: %v", err)
+			return nil, dbError("scan failed", err)
 		}
 		brokerages = append(brokerages, b)
 	}
@@ -122,21 +145,34 @@ func GetAllBrokerages() ([]Brokerage, error) {
 	return brokerages, nil
 }
 
-// Retrieve recommendations
-func GetRecommendations(limit, offset int, ticker, brokerageID string) ([]Recommendation, int, error) {
+// Get brokerage by id
+func (s *PostgresStore) GetBrokerage(ctx context.Context, id string) (*Brokerage, error) {
 	conn, err := connection.GetDatabaseConnection()
 	if err != nil {
-		return nil, 0, fmt.Errorf("database connection failed: %v", err)
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
 	}
 	defer conn.CloseConn(context.Background())
 
-	ctx := context.Background()
+	var b Brokerage
+	err = conn.QueryRow(ctx, `
+		SELECT id, name, created_at, updated_at
+		FROM brokerage
+		WHERE id::text = $1`,
+		id).Scan(&b.ID, &b.Name, &b.CreatedAt, &b.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("brokerage %s: %w", id, ErrNotFound)
+	} else if err != nil {
+		return nil, dbError("brokerage query failed", err)
+	}
+	return &b, nil
+}
 
-	//Filtered query
-	baseQuery := `
+// recommendationSelect selects the columns read by scanRecommendation
+const recommendationSelect = `
 		SELECT
-			ar.id, ar.target_from, ar.target_to, ar.rating_from, ar.rating_to,
-			ar.action, ar.time, ar.created_at, ar.updated_at,
+			ar.id, ar.target_from, ar.target_to, COALESCE(ar.currency, ''), ar.rating_from, ar.rating_to,
+			ar.rating_from_score, ar.rating_to_score, ar.action,
+			COALESCE(ar.event_type, ''), ar.rating_direction, ar.target_direction, ar.time, ar.source, ar.created_at, ar.updated_at,
 			c.id, c.ticker, c.name, c.created_at, c.updated_at,
 			b.id, b.name, b.created_at, b.updated_at
 		FROM analyst_recommendation ar
@@ -144,6 +180,37 @@ func GetRecommendations(limit, offset int, ticker, brokerageID string) ([]Recomm
 		LEFT JOIN brokerage b ON ar.brokerage_id = b.id
 	`
 
+// Retrieve recommendations
+func (s *PostgresStore) ListRecommendations(ctx context.Context, filter RecommendationFilter) ([]Recommendation, int, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, 0, err
+	}
+	desc, err := checkCursor(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort := filter.Sort
+	reverse := false
+	var cursorOp string
+	if filter.Cursor != nil {
+		//Pages before the cursor are read backwards from it, then put back in order
+		cursorOp, reverse = cursorQuery(filter.Cursor, desc)
+		sort = []SortKey{{Field: "time", Desc: desc != reverse}}
+	}
+	order, err := orderBy(sort, defaultRecommendationSort, recommendationSortColumns, "ar.id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, 0, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	//Filtered query
+	baseQuery := recommendationSelect
+
 	countQuery := `
 		SELECT COUNT(*)
 		FROM analyst_recommendation ar
@@ -151,68 +218,244 @@ func GetRecommendations(limit, offset int, ticker, brokerageID string) ([]Recomm
 		LEFT JOIN brokerage b ON ar.brokerage_id = b.id
 	`
 
-	whereClause := ""
-	args := []interface{}{}
-	argsIndex := 1
+	whereClause, args := recommendationWhere(filter)
 
-	if ticker != "" {
-		whereClause += fmt.Sprintf(" WHERE c.ticker = $%d", argsIndex)
-		args = append(args, ticker)
-		argsIndex++
+	//The total ignores the cursor, it counts every match of the filter
+	totalCount := -1
+	if !filter.SkipCount {
+		err = conn.QueryRow(ctx, countQuery+whereClause, args...).Scan(&totalCount)
+		if err != nil {
+			return nil, 0, dbError("failed to get total count", err)
+		}
 	}
 
-	if brokerageID != "" {
+	if filter.Cursor != nil {
 		if whereClause == "" {
-			whereClause += fmt.Sprintf(" WHERE ar.brokerage_id = $%d", argsIndex)
+			whereClause = " WHERE "
 		} else {
-			whereClause += fmt.Sprintf(" AND ar.brokerage_id = $%d", argsIndex)
+			whereClause += " AND "
 		}
-		args = append(args, brokerageID)
-		argsIndex++
-	}
-
-	var totalCount int
-	err = conn.QueryRow(ctx, countQuery+whereClause, args...).Scan(&totalCount)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get total count: %v", err)
+		whereClause += fmt.Sprintf("(ar.time, ar.id) %s ($%d, $%d::uuid)", cursorOp, len(args)+1, len(args)+2)
+		args = append(args, filter.Cursor.Time, filter.Cursor.ID)
 	}
+	argsIndex := len(args) + 1
 
 	//Get recommendations
-	finalQuery := baseQuery + whereClause + fmt.Sprintf(" ORDER BY ar.time DESC LIMIT $%d OFFSET $%d", argsIndex, argsIndex+1)
-	args = append(args, limit, offset)
+	finalQuery := baseQuery + whereClause + order + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argsIndex, argsIndex+1)
+	args = append(args, filter.Limit, filter.Offset)
 
 	rows, err := conn.Query(ctx, finalQuery, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("query failed: %v", err)
+		return nil, 0, dbError("query failed", err)
 	}
 	defer rows.Close()
 
 	var recommendations []Recommendation
 	for rows.Next() {
-		var r Recommendation
-		var dbBrokerageID, dbBrokerageName *string
-		var dbBrokerageCreatedAt, dbBrokerageUpdatedAt *time.Time
-
-		err := rows.Scan(
-			&r.ID, &r.TargetFrom, &r.TargetTo, &r.RatingFrom, &r.RatingTo,
-			&r.Action, &r.Time, &r.CreatedAt, &r.UpdatedAt,
-			&r.Company.ID, &r.Company.Ticker, &r.Company.Name, &r.Company.CreatedAt, &r.Company.UpdatedAt,
-			&dbBrokerageID, &dbBrokerageName, &dbBrokerageCreatedAt, &dbBrokerageUpdatedAt,
-		)
+		r, err := scanRecommendation(rows)
 		if err != nil {
-			return nil, 0, fmt.Errorf("scan failed: %v", err)
-		}
-
-		//Handle multiple brokerages
-		if dbBrokerageID != nil {
-			r.Brokerage = &Brokerage{
-				ID:        *dbBrokerageID,
-				Name:      *dbBrokerageName,
-				CreatedAt: *dbBrokerageCreatedAt,
-				UpdatedAt: *dbBrokerageUpdatedAt,
-			}
+			return nil, 0, err
 		}
 		recommendations = append(recommendations, r)
 	}
+	if reverse {
+		reverseRecommendations(recommendations)
+	}
 	return recommendations, totalCount, nil
 }
+
+func reverseRecommendations(recommendations []Recommendation) {
+	for i, j := 0, len(recommendations)-1; i < j; i, j = i+1, j-1 {
+		recommendations[i], recommendations[j] = recommendations[j], recommendations[i]
+	}
+}
+
+// StreamRecommendations reads every recommendation matching filter row by row,
+// ignoring Limit and Offset, so exports never hold the full result in memory
+func (s *PostgresStore) StreamRecommendations(ctx context.Context, filter RecommendationFilter, fn func(Recommendation) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	order, err := orderBy(filter.Sort, defaultRecommendationSort, recommendationSortColumns, "ar.id")
+	if err != nil {
+		return err
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	whereClause, args := recommendationWhere(filter)
+	rows, err := conn.Query(ctx, recommendationSelect+whereClause+order, args...)
+	if err != nil {
+		return dbError("query failed", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanRecommendation(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// recommendationWhere builds the WHERE clause of filter, numbering arguments from $1
+func recommendationWhere(filter RecommendationFilter) (string, []interface{}) {
+	var conditions []string
+	args := []interface{}{}
+
+	//Each condition takes one argument, written where %s is
+	and := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.Ticker != "" {
+		and("c.ticker = %s", filter.Ticker)
+	}
+	if filter.BrokerageID != "" {
+		and("ar.brokerage_id = %s", filter.BrokerageID)
+	}
+	if filter.Source != "" {
+		and("ar.source = %s", filter.Source)
+	}
+	if filter.EventType != "" {
+		and("ar.event_type = %s", string(filter.EventType))
+	}
+	if len(filter.Tickers) > 0 {
+		and("c.ticker = ANY(%s)", filter.Tickers)
+	}
+	if len(filter.Actions) > 0 {
+		and("LOWER(ar.action) = ANY(%s)", lowerAll(filter.Actions))
+	}
+	if len(filter.RatingsTo) > 0 {
+		and("LOWER(ar.rating_to) = ANY(%s)", lowerAll(filter.RatingsTo))
+	}
+	if filter.From != nil {
+		and("ar.time >= %s", *filter.From)
+	}
+	if filter.To != nil {
+		and("ar.time < %s", *filter.To)
+	}
+	if filter.MinTarget != nil {
+		and("ar.target_to >= %s", *filter.MinTarget)
+	}
+	if filter.MaxTarget != nil {
+		and("ar.target_to <= %s", *filter.MaxTarget)
+	}
+	//Same formula as TargetChange
+	const targetChange = "ar.target_from > 0 AND (ar.target_to - ar.target_from) / ar.target_from * 100"
+	if filter.MinTargetChange != nil {
+		and(targetChange+" >= %s", *filter.MinTargetChange)
+	}
+	if filter.MaxTargetChange != nil {
+		and(targetChange+" <= %s", *filter.MaxTargetChange)
+	}
+	if filter.Company != "" {
+		and("c.name ILIKE '%%' || %s || '%%'", escapeLike(filter.Company))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// lowerAll lower-cases every value
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
+
+// withConnection runs fn on a connection released as soon as fn returns, so
+// long runs only hold a pool slot while they talk to the database
+func withConnection(fn func(conn connection.DBConnection) error) error {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+	return fn(conn)
+}
+
+// uuidPattern matches the text form of UUIDs, in any case
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isUUID reports whether s can be cast to uuid by Postgres without failing
+func isUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// Validate rejects ids Postgres could not cast to uuid
+func (filter RecommendationFilter) Validate() error {
+	if filter.BrokerageID != "" && !isUUID(filter.BrokerageID) {
+		return newError(ErrInvalidInput, "invalid brokerage id %q", filter.BrokerageID)
+	}
+	return nil
+}
+
+// escapeLike escapes the LIKE wildcards of s, so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Get recommendation by id
+func (s *PostgresStore) GetRecommendation(ctx context.Context, id string) (*Recommendation, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	r, err := scanRecommendation(conn.QueryRow(ctx, recommendationSelect+" WHERE ar.id::text = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("recommendation %s: %w", id, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// UpsertRecommendations stores recommendations through SaveRecommendations
+func (s *PostgresStore) UpsertRecommendations(ctx context.Context, recommendations []RecommendationData, opts SaveOptions) (SaveResult, error) {
+	return saveRecommendations(ctx, recommendations, opts)
+}
+
+// scanRecommendation reads a row selected with recommendationSelect
+func scanRecommendation(row pgx.Row) (Recommendation, error) {
+	var r Recommendation
+	var dbBrokerageID, dbBrokerageName *string
+	var dbBrokerageCreatedAt, dbBrokerageUpdatedAt *time.Time
+
+	err := row.Scan(
+		&r.ID, &r.TargetFrom, &r.TargetTo, &r.Currency, &r.RatingFrom, &r.RatingTo,
+		&r.RatingFromScore, &r.RatingToScore, &r.Action,
+		&r.EventType, &r.RatingDirection, &r.TargetDirection, &r.Time, &r.Source, &r.CreatedAt, &r.UpdatedAt,
+		&r.Company.ID, &r.Company.Ticker, &r.Company.Name, &r.Company.CreatedAt, &r.Company.UpdatedAt,
+		&dbBrokerageID, &dbBrokerageName, &dbBrokerageCreatedAt, &dbBrokerageUpdatedAt,
+	)
+	if err != nil {
+		return r, dbError("scan failed", err)
+	}
+
+	//Handle multiple brokerages
+	if dbBrokerageID != nil {
+		r.Brokerage = &Brokerage{
+			ID:        *dbBrokerageID,
+			Name:      *dbBrokerageName,
+			CreatedAt: *dbBrokerageCreatedAt,
+			UpdatedAt: *dbBrokerageUpdatedAt,
+		}
+	}
+	return r, nil
+}
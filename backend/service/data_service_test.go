@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendationWhere(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	minChange := 10.0
+
+	where, args := recommendationWhere(RecommendationFilter{})
+	assert.Empty(t, where)
+	assert.Empty(t, args)
+
+	where, args = recommendationWhere(RecommendationFilter{
+		Source:          "api",
+		Tickers:         []string{"AAPL", "MSFT"},
+		Actions:         []string{"Upgraded By"},
+		From:            &from,
+		MinTargetChange: &minChange,
+		Company:         "50%_off",
+	})
+	assert.Equal(t, " WHERE ar.source = $1 AND c.ticker = ANY($2) AND LOWER(ar.action) = ANY($3)"+
+		" AND ar.time >= $4"+
+		" AND ar.target_from > 0 AND (ar.target_to - ar.target_from) / ar.target_from * 100 >= $5"+
+		" AND c.name ILIKE '%' || $6 || '%'", where)
+	assert.Equal(t, []interface{}{
+		"api", []string{"AAPL", "MSFT"}, []string{"upgraded by"}, from, 10.0, `50\%\_off`,
+	}, args)
+}
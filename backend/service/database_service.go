@@ -6,8 +6,6 @@ import (
 	"log"
 	"stock-investment-backend/connection"
 	"time"
-
-	"github.com/jackc/pgx/v4"
 )
 
 type RecommendationData struct {
@@ -20,138 +18,106 @@ type RecommendationData struct {
 	RatingFrom string    `json:"rating_from"`
 	RatingTo   string    `json:"rating_to"`
 	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
 }
 
-// Ctx is context.Context that handles request timeouts, cancellations and deadlines. Prevents queries from hanging indefinitely. Allows to stop operations if needed. Required for database operations.
-func InsertOrGetCompany(conn connection.DBConnection, ctx context.Context, ticker, name string) (string, error) {
-	var companyID string
-
-	err := conn.QueryRow(ctx,
-		"SELECT id FROM company WHERE ticker = $1",
-		ticker).Scan(&companyID)
-
-	if err == pgx.ErrNoRows {
-		err = conn.QueryRow(ctx,
-			`INSERT INTO company (ticker, name)
-			VALUES ($1, $2)
-			ON CONFLICT (ticker) DO UPDATE SET
-			name = EXCLUDED.name, updated_at = now()
-			RETURNING id`,
-			ticker, name).Scan(&companyID)
-
-		if err != nil {
-			return "", fmt.Errorf("failed to query company: %w", err)
-		}
-	} else if err != nil {
-		return "", fmt.Errorf("failed to query company: %w", err)
+// sourceName returns the source the recommendation is recorded under
+func (d RecommendationData) sourceName() string {
+	if d.Source == "" {
+		return DefaultSourceName
 	}
-
-	return companyID, nil
+	return d.Source
 }
 
-func InsertOrGetBrokerage(conn connection.DBConnection, ctx context.Context, name string) (string, error) {
-	var brokerageID string
-
-	err := conn.QueryRow(ctx,
-		"SELECT id FROM brokerage WHERE name = $1",
-		name).Scan(&brokerageID)
-
-	if err == pgx.ErrNoRows {
-		err = conn.QueryRow(ctx,
-			`INSERT INTO brokerage (name)
-				VALUES ($1)
-				ON CONFLICT (name) DO UPDATE SET
-				updated_at = now()
-				RETURNING id`,
-			name).Scan(&brokerageID)
-
-		if err != nil {
-			return "", fmt.Errorf("failed to query brokerage: %w", err)
-		}
-	} else if err != nil {
-		return "", fmt.Errorf("failed to query brokerage: %w", err)
+func (o SaveOptions) batchFailed(batch []RecommendationData, err error) {
+	if o.OnBatchError != nil {
+		o.OnBatchError(batch, err)
 	}
+}
 
-	return brokerageID, nil
+// SaveRecommendations saves multiple recommendations to the database in a single
+// transaction. In SaveBatch mode every batch runs under its own savepoint and a
+// failing batch is counted as failed without aborting the others; in SaveAtomic
+// mode the first failure rolls back everything.
+func SaveRecommendations(recommendations []RecommendationData, opts SaveOptions) (SaveResult, error) {
+	return saveRecommendations(context.Background(), recommendations, opts)
 }
 
-func InsertRecommendation(conn connection.DBConnection, ctx context.Context, data RecommendationData) error {
-	//Get or create company
-	companyID, err := InsertOrGetCompany(conn, ctx, data.Ticker, data.Company)
-	if err != nil {
-		return fmt.Errorf("failed to insert or get company: %v", err)
-	}
+func saveRecommendations(ctx context.Context, recommendations []RecommendationData, opts SaveOptions) (SaveResult, error) {
+	var result SaveResult
 
-	//Get or create brokerage
-	brokerageID, err := InsertOrGetBrokerage(conn, ctx, data.Brokerage)
-	if err != nil {
-		return fmt.Errorf("failed to insert or get brokerage: %v", err)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
 	}
 
-	//Parse target prices and handle empty strings
-	var targetFrom, targetTo *float64
-	if data.TargetFrom != "" && data.TargetFrom != "$0.00" {
-		var tf float64
-		_, err := fmt.Sscanf(data.TargetFrom, "$%f", &tf)
-		if err == nil {
-			targetFrom = &tf
-		}
+	//Failed batches are reported once the connection is back in the pool,
+	//OnBatchError records them on a connection of its own
+	type failure struct {
+		batch []RecommendationData
+		err   error
 	}
-
-	if data.TargetTo != "" && data.TargetTo != "$0.00" {
-		var tt float64
-		_, err := fmt.Sscanf(data.TargetTo, "$%f", &tt)
-		if err == nil {
-			targetTo = &tt
+	var failures []failure
+	defer func() {
+		for _, f := range failures {
+			opts.batchFailed(f.batch, f.err)
 		}
-	}
+	}()
 
-	// Insert analyst recommendation
-	_, err = conn.Exec(ctx,
-		`INSERT INTO analyst_recommendation 
-		(company_id, brokerage_id, target_from, target_to, rating_from, rating_to, action, time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		companyID, brokerageID, targetFrom, targetTo, data.RatingFrom, data.RatingTo, data.Action, data.Time)
-	if err != nil {
-		return fmt.Errorf("failed to insert analyst recommendation: %v", err)
-	}
-
-	return nil
-}
-
-// SaveRecommendations saves multiple recommendations to the database
-func SaveRecommendations(recommendations []RecommendationData) error {
 	conn, err := connection.GetDatabaseConnection()
 	if err != nil {
-		return fmt.Errorf("failed to get database connection: %v", err)
+		return result, fmt.Errorf("failed to get database connection: %w", err)
 	}
 	defer conn.CloseConn(context.Background())
 
-	ctx := context.Background()
-
 	//Start transaction
 	tx, err := conn.BeginConn(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	successCount := 0
-	for i, rec := range recommendations {
-		err := InsertRecommendation(conn, ctx, rec)
+	if opts.Mode == SaveAtomic {
+		batchResult, err := saveBatch(tx, ctx, recommendations)
 		if err != nil {
-			log.Printf("Error inserting recommendation %d: %v", i, err)
-			continue
+			failures = append(failures, failure{recommendations, err})
+			return SaveResult{Failed: len(recommendations)}, fmt.Errorf("failed to save recommendations, transaction rolled back: %w", err)
+		}
+		result = batchResult
+	} else {
+		for start := 0; start < len(recommendations); start += opts.BatchSize {
+			end := start + opts.BatchSize
+			if end > len(recommendations) {
+				end = len(recommendations)
+			}
+			batch := recommendations[start:end]
+
+			//Nested transactions are savepoints in pgx
+			savepoint, err := tx.Begin(ctx)
+			if err != nil {
+				return result, fmt.Errorf("failed to create savepoint: %w", err)
+			}
+
+			batchResult, err := saveBatch(savepoint, ctx, batch)
+			if err != nil {
+				log.Printf("Error saving recommendations %d-%d, batch skipped: %v", start, end-1, err)
+				savepoint.Rollback(ctx)
+				result.Failed += len(batch)
+				failures = append(failures, failure{batch, err})
+				continue
+			}
+			if err := savepoint.Commit(ctx); err != nil {
+				return result, fmt.Errorf("failed to release savepoint: %w", err)
+			}
+			result.Add(batchResult)
 		}
-		successCount++
 	}
 
 	//Commit transaction
 	err = tx.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return SaveResult{Failed: len(recommendations)}, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	log.Printf("Successfully inserted %d recommendations", successCount)
-	return nil
+	log.Printf("Saved recommendations: %s", result)
+	return result, nil
 }
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"stock-investment-backend/connection"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SaveResult counts the outcome of saving a batch of recommendations
+type SaveResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+// Add accumulates the counts of another result
+func (r *SaveResult) Add(other SaveResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+	r.Failed += other.Failed
+}
+
+func (r SaveResult) String() string {
+	return fmt.Sprintf("%d inserted, %d updated, %d unchanged, %d failed", r.Inserted, r.Updated, r.Unchanged, r.Failed)
+}
+
+// Fingerprint returns the hex SHA-256 of the recommendation's natural key:
+// company, brokerage, action, ratings, targets and time. Text fields are
+// case and whitespace normalized and targets are reduced to their amount, so
+// the same upstream event always maps to the same fingerprint.
+func (d RecommendationData) Fingerprint() string {
+	key := strings.Join([]string{
+		normalizeTicker(d.Ticker),
+		normalizeKeyText(d.Brokerage),
+		normalizeKeyText(d.Action),
+		normalizeKeyText(d.RatingFrom),
+		normalizeKeyText(d.RatingTo),
+		fingerprintAmount(d.TargetFrom),
+		fingerprintAmount(d.TargetTo),
+		d.Time.UTC().Format(time.RFC3339Nano),
+	}, "\x1f")
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeTicker is the ticker recommendations and companies are keyed by
+func normalizeTicker(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+func normalizeKeyText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// fingerprintAmount reads a price like ParsePrice so formatting differences
+// ("$1,234.50", "$1234.5" or "1.234,50 USD") do not change the key, and keys
+// it with its currency. Empty and unparseable amounts collapse to "", zero is
+// a target like any other.
+func fingerprintAmount(s string) string {
+	price, err := ParsePrice(s)
+	if err != nil || price == nil {
+		return ""
+	}
+	return strconv.FormatFloat(price.Amount, 'f', 2, 64) + " " + price.Currency
+}
+
+// BackfillFingerprints computes the fingerprint of recommendations stored before
+// deduplication existed and deletes the rows that turn out to be duplicates.
+func BackfillFingerprints() (updated int, deleted int, err error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	ctx := context.Background()
+	tx, err := conn.BeginConn(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT ar.id, c.ticker, COALESCE(b.name, ''), ar.action,
+			COALESCE(ar.rating_from, ''), COALESCE(ar.rating_to, ''),
+			ar.target_from::float8, ar.target_to::float8, COALESCE(ar.currency, ''), ar.time
+		FROM analyst_recommendation ar
+		JOIN company c ON ar.company_id = c.id
+		LEFT JOIN brokerage b ON ar.brokerage_id = b.id
+		WHERE ar.fingerprint IS NULL
+		ORDER BY ar.created_at ASC, ar.id ASC
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query failed: %w", err)
+	}
+
+	type legacyRow struct {
+		id          string
+		fingerprint string
+	}
+	var legacy []legacyRow
+	for rows.Next() {
+		var id string
+		var data RecommendationData
+		var targetFrom, targetTo *float64
+		var currency string
+		err := rows.Scan(&id, &data.Ticker, &data.Brokerage, &data.Action,
+			&data.RatingFrom, &data.RatingTo, &targetFrom, &targetTo, &currency, &data.Time)
+		if err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("scan failed: %w", err)
+		}
+		if targetFrom != nil {
+			data.TargetFrom = FormatPrice(*targetFrom, currency)
+		}
+		if targetTo != nil {
+			data.TargetTo = FormatPrice(*targetTo, currency)
+		}
+		legacy = append(legacy, legacyRow{id: id, fingerprint: data.Fingerprint()})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("query failed: %w", err)
+	}
+
+	for _, row := range legacy {
+		//The oldest copy keeps the fingerprint, later copies from the same source are duplicates
+		tag, err := tx.Exec(ctx,
+			`UPDATE analyst_recommendation ar SET fingerprint = $2
+			WHERE ar.id = $1
+			AND NOT EXISTS (
+				SELECT 1 FROM analyst_recommendation other
+				WHERE other.fingerprint = $2 AND other.source = ar.source
+			)`,
+			row.id, row.fingerprint)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to update fingerprint: %w", err)
+		}
+		if tag.RowsAffected() == 1 {
+			updated++
+			continue
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM analyst_recommendation WHERE id = $1", row.id)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to delete duplicate recommendation: %w", err)
+		}
+		deleted++
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Fingerprinted %d recommendations, removed %d duplicates", updated, deleted)
+	return updated, deleted, nil
+}
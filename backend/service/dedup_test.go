@@ -0,0 +1,96 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func baseRecommendationData() RecommendationData {
+	return RecommendationData{
+		Ticker:     "AAPL",
+		TargetFrom: "$180.00",
+		TargetTo:   "$1,200.50",
+		Company:    "Apple Inc.",
+		Action:     "target raised by",
+		Brokerage:  "Goldman Sachs",
+		RatingFrom: "Buy",
+		RatingTo:   "Buy",
+		Time:       time.Date(2025, 1, 10, 0, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestFingerprint_IsStableAcrossFormatting(t *testing.T) {
+	base := baseRecommendationData()
+
+	variant := base
+	variant.Ticker = " aapl "
+	variant.Brokerage = "goldman  sachs"
+	variant.Action = "Target Raised By"
+	variant.TargetFrom = "$180"
+	variant.TargetTo = "1.200,50 USD"
+	variant.Company = "Apple"
+	variant.Time = base.Time.In(time.FixedZone("EST", -5*3600))
+
+	assert.Equal(t, base.Fingerprint(), variant.Fingerprint())
+	assert.Len(t, base.Fingerprint(), 64)
+}
+
+func TestFingerprint_ChangesWithNaturalKey(t *testing.T) {
+	base := baseRecommendationData()
+
+	tests := []struct {
+		name   string
+		modify func(d *RecommendationData)
+	}{
+		{name: "ticker", modify: func(d *RecommendationData) { d.Ticker = "MSFT" }},
+		{name: "brokerage", modify: func(d *RecommendationData) { d.Brokerage = "Morgan Stanley" }},
+		{name: "action", modify: func(d *RecommendationData) { d.Action = "upgraded by" }},
+		{name: "rating from", modify: func(d *RecommendationData) { d.RatingFrom = "Hold" }},
+		{name: "rating to", modify: func(d *RecommendationData) { d.RatingTo = "Strong-Buy" }},
+		{name: "target from", modify: func(d *RecommendationData) { d.TargetFrom = "$181.00" }},
+		{name: "target to", modify: func(d *RecommendationData) { d.TargetTo = "" }},
+		{name: "currency", modify: func(d *RecommendationData) { d.TargetFrom = "€180.00" }},
+		{name: "time", modify: func(d *RecommendationData) { d.Time = d.Time.Add(time.Second) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := base
+			tt.modify(&changed)
+			assert.NotEqual(t, base.Fingerprint(), changed.Fingerprint())
+		})
+	}
+}
+
+func TestFingerprintAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "$1,234.50", expected: "1234.50 USD"},
+		{input: "1.234,50 USD", expected: "1234.50 USD"},
+		{input: "1.234,50 €", expected: "1234.50 EUR"},
+		{input: "$45", expected: "45.00 USD"},
+		{input: "45 GBP", expected: "45.00 GBP"},
+		{input: "$0.00", expected: "0.00 USD"},
+		{input: "$0", expected: "0.00 USD"},
+		{input: "", expected: ""},
+		{input: "N/A", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, fingerprintAmount(tt.input))
+		})
+	}
+}
+
+func TestSaveResult_Add(t *testing.T) {
+	total := SaveResult{Inserted: 1, Unchanged: 1}
+	total.Add(SaveResult{Inserted: 2, Updated: 1, Failed: 3})
+
+	assert.Equal(t, SaveResult{Inserted: 3, Updated: 1, Unchanged: 1, Failed: 3}, total)
+	assert.Equal(t, "3 inserted, 1 updated, 1 unchanged, 3 failed", total.String())
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"stock-investment-backend/connection"
+	"strings"
+	"time"
+)
+
+// DriftMode is how a sync reacts to payloads that do not match the expected schema
+type DriftMode string
+
+const (
+	// DriftOff does not track payload fields
+	DriftOff DriftMode = "off"
+	// DriftWarn logs the drift and keeps syncing
+	DriftWarn DriftMode = "warn"
+	// DriftFail stops the sync at the first page that drifts, before converting it
+	DriftFail DriftMode = "fail"
+)
+
+// ParseDriftMode parses the -schema-drift flag, empty means warn
+func ParseDriftMode(s string) (DriftMode, error) {
+	switch DriftMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", DriftWarn:
+		return DriftWarn, nil
+	case DriftFail:
+		return DriftFail, nil
+	case DriftOff:
+		return DriftOff, nil
+	}
+	return "", fmt.Errorf("invalid schema drift mode %q (expected warn, fail or off)", s)
+}
+
+// ErrSchemaDrift is returned by syncs in DriftFail mode
+var ErrSchemaDrift = errors.New("schema drift")
+
+// schemaField is the expected JSON type of a payload field
+type schemaField struct {
+	Type string
+	// Required fields are reported missing when an item lacks them, optional ones are not
+	Required bool
+}
+
+// recommendationSchema lists every field convertRecommendationData reads. Ratings
+// and targets are often left out by the upstream API, e.g. for initiations.
+var recommendationSchema = map[string]schemaField{
+	"ticker":      {Type: "string", Required: true},
+	"company":     {Type: "string", Required: true},
+	"action":      {Type: "string", Required: true},
+	"brokerage":   {Type: "string", Required: true},
+	"time":        {Type: "string", Required: true},
+	"rating_from": {Type: "string"},
+	"rating_to":   {Type: "string"},
+	"target_from": {Type: "string"},
+	"target_to":   {Type: "string"},
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// SchemaReport compares the fields observed by a run with the expected schema
+type SchemaReport struct {
+	RunID  string `json:"run_id"`
+	Source string `json:"source"`
+	Items  int    `json:"items"`
+	// Fields counts the items carrying each field, by JSON type
+	Fields map[string]map[string]int `json:"fields"`
+	// New lists fields the schema does not know
+	New []string `json:"new_fields"`
+	// Missing lists required fields absent from some items
+	Missing []string `json:"missing_fields"`
+	// Retyped lists expected fields seen with another type; null is always accepted
+	Retyped   []string  `json:"retyped_fields"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Drifted reports whether the payloads did not match the schema
+func (r SchemaReport) Drifted() bool {
+	return len(r.New)+len(r.Missing)+len(r.Retyped) > 0
+}
+
+func (r SchemaReport) String() string {
+	if !r.Drifted() {
+		return fmt.Sprintf("%d items match the schema", r.Items)
+	}
+	var parts []string
+	if len(r.New) > 0 {
+		parts = append(parts, "new fields: "+strings.Join(r.New, ", "))
+	}
+	if len(r.Missing) > 0 {
+		missing := make([]string, len(r.Missing))
+		for i, field := range r.Missing {
+			missing[i] = fmt.Sprintf("%s (absent from %d of %d items)", field, r.Items-r.seen(field), r.Items)
+		}
+		parts = append(parts, "missing fields: "+strings.Join(missing, ", "))
+	}
+	if len(r.Retyped) > 0 {
+		retyped := make([]string, len(r.Retyped))
+		for i, field := range r.Retyped {
+			types := make([]string, 0, len(r.Fields[field]))
+			for t := range r.Fields[field] {
+				types = append(types, t)
+			}
+			sort.Strings(types)
+			retyped[i] = fmt.Sprintf("%s (%s)", field, strings.Join(types, "|"))
+		}
+		parts = append(parts, "retyped fields: "+strings.Join(retyped, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// seen counts the items carrying field
+func (r SchemaReport) seen(field string) int {
+	total := 0
+	for _, n := range r.Fields[field] {
+		total += n
+	}
+	return total
+}
+
+// schemaTracker accumulates the fields of the raw items of a run
+type schemaTracker struct {
+	expected map[string]schemaField
+	items    int
+	fields   map[string]map[string]int
+}
+
+func newSchemaTracker(expected map[string]schemaField) *schemaTracker {
+	return &schemaTracker{expected: expected, fields: make(map[string]map[string]int)}
+}
+
+func (t *schemaTracker) observe(items []map[string]interface{}) {
+	for _, item := range items {
+		t.items++
+		for field, value := range item {
+			types := t.fields[field]
+			if types == nil {
+				types = make(map[string]int)
+				t.fields[field] = types
+			}
+			types[jsonType(value)]++
+		}
+	}
+}
+
+func (t *schemaTracker) report() SchemaReport {
+	report := SchemaReport{
+		Items:   t.items,
+		Fields:  t.fields,
+		New:     []string{},
+		Missing: []string{},
+		Retyped: []string{},
+	}
+	for field, types := range t.fields {
+		expected, known := t.expected[field]
+		if !known {
+			report.New = append(report.New, field)
+			continue
+		}
+		for observed := range types {
+			if observed != expected.Type && observed != "null" {
+				report.Retyped = append(report.Retyped, field)
+				break
+			}
+		}
+	}
+	for field, expected := range t.expected {
+		if expected.Required && report.seen(field) < t.items {
+			report.Missing = append(report.Missing, field)
+		}
+	}
+	sort.Strings(report.New)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Retyped)
+	return report
+}
+
+// driftCheck tracks the payloads of a sync according to its DriftMode
+type driftCheck struct {
+	mode    DriftMode
+	source  string
+	tracker *schemaTracker
+	warned  bool
+}
+
+func newDriftCheck(mode DriftMode, source string) *driftCheck {
+	return &driftCheck{mode: mode, source: source, tracker: newSchemaTracker(recommendationSchema)}
+}
+
+// page observes the raw items of a page. In DriftFail mode it returns an
+// error wrapping ErrSchemaDrift once the run has drifted.
+func (c *driftCheck) page(items []map[string]interface{}) error {
+	if c.mode == DriftOff {
+		return nil
+	}
+	c.tracker.observe(items)
+	report := c.tracker.report()
+	if !report.Drifted() {
+		return nil
+	}
+	if c.mode == DriftFail {
+		return fmt.Errorf("%w in %s payloads: %s", ErrSchemaDrift, c.source, report)
+	}
+	if !c.warned {
+		log.Printf("⚠️  Schema drift in %s payloads: %s", c.source, report)
+		c.warned = true
+	}
+	return nil
+}
+
+// record stores the report of the run, unless nothing was observed
+func (c *driftCheck) record(run *ingestRecorder) {
+	if c.mode == DriftOff || c.tracker.items == 0 {
+		return
+	}
+	report := c.tracker.report()
+	if report.Drifted() {
+		fmt.Printf("⚠️  Schema drift: %s\n", report)
+	}
+	run.schemaReport(c.source, report)
+}
+
+// schemaReport stores the schema report of the run
+func (r *ingestRecorder) schemaReport(source string, report SchemaReport) {
+	if r == nil {
+		return
+	}
+	fields, err := json.Marshal(report.Fields)
+	if err != nil {
+		log.Printf("⚠️  Schema report not recorded: %v", err)
+		return
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		log.Printf("⚠️  Schema report not recorded: %v", err)
+		return
+	}
+	defer conn.CloseConn(context.Background())
+
+	_, err = conn.Exec(context.Background(), `
+		INSERT INTO schema_report (run_id, source, items, fields, new_fields, missing_fields, retyped_fields, drifted)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6, $7, $8)`,
+		r.id, source, report.Items, string(fields), report.New, report.Missing, report.Retyped, report.Drifted())
+	if err != nil {
+		log.Printf("⚠️  Schema report not recorded: %v", err)
+	}
+}
+
+// SchemaReportFilter selects schema reports, empty fields match everything
+type SchemaReportFilter struct {
+	Source string
+	// DriftedOnly skips the runs whose payloads matched the schema
+	DriftedOnly bool
+}
+
+func (s *PostgresStore) ListSchemaReports(ctx context.Context, filter SchemaReportFilter, limit, offset int) ([]SchemaReport, int, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, 0, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	where := "WHERE ($1 = '' OR source = $1) AND (NOT $2 OR drifted)"
+	var total int
+	if err := conn.QueryRow(ctx, "SELECT COUNT(*) FROM schema_report "+where, filter.Source, filter.DriftedOnly).Scan(&total); err != nil {
+		return nil, 0, dbError("count query failed", err)
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT run_id, source, items, fields::text, new_fields, missing_fields, retyped_fields, created_at
+		FROM schema_report `+where+`
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`,
+		filter.Source, filter.DriftedOnly, limit, offset)
+	if err != nil {
+		return nil, 0, dbError("query failed", err)
+	}
+	defer rows.Close()
+
+	var reports []SchemaReport
+	for rows.Next() {
+		var r SchemaReport
+		var fields string
+		err := rows.Scan(&r.RunID, &r.Source, &r.Items, &fields, &r.New, &r.Missing, &r.Retyped, &r.CreatedAt)
+		if err != nil {
+			return nil, 0, dbError("scan failed", err)
+		}
+		if err := json.Unmarshal([]byte(fields), &r.Fields); err != nil {
+			return nil, 0, fmt.Errorf("invalid fields of run %s: %w", r.RunID, err)
+		}
+		reports = append(reports, r)
+	}
+	return reports, total, rows.Err()
+}
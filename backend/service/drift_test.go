@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validItem() map[string]interface{} {
+	return map[string]interface{}{
+		"ticker": "AAPL", "company": "Apple Inc.", "action": "upgraded by", "brokerage": "Goldman Sachs",
+		"rating_from": "Hold", "rating_to": "Buy", "target_from": "$100.00", "target_to": "$120.00",
+		"time": "2025-01-10T00:30:00Z",
+	}
+}
+
+func TestParseDriftMode(t *testing.T) {
+	for input, want := range map[string]DriftMode{"": DriftWarn, "warn": DriftWarn, "FAIL": DriftFail, " off ": DriftOff} {
+		mode, err := ParseDriftMode(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, mode)
+	}
+
+	_, err := ParseDriftMode("strict")
+	assert.Error(t, err)
+}
+
+func TestSchemaTracker_Report(t *testing.T) {
+	renamed := validItem()
+	delete(renamed, "ticker")
+	renamed["symbol"] = "AAPL"
+
+	optional := validItem()
+	delete(optional, "target_from")
+	delete(optional, "rating_from")
+
+	retyped := validItem()
+	retyped["target_from"] = 100.0
+	retyped["rating_from"] = nil
+
+	tests := []struct {
+		name        string
+		items       []map[string]interface{}
+		wantNew     []string
+		wantMissing []string
+		wantRetyped []string
+	}{
+		{"matching", []map[string]interface{}{validItem(), validItem()}, []string{}, []string{}, []string{}},
+		{"renamed field", []map[string]interface{}{validItem(), renamed}, []string{"symbol"}, []string{"ticker"}, []string{}},
+		{"optional fields left out", []map[string]interface{}{validItem(), optional}, []string{}, []string{}, []string{}},
+		{"retyped field, null accepted", []map[string]interface{}{retyped}, []string{}, []string{}, []string{"target_from"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newSchemaTracker(recommendationSchema)
+			tracker.observe(tt.items)
+			report := tracker.report()
+
+			assert.Equal(t, len(tt.items), report.Items)
+			assert.Equal(t, tt.wantNew, report.New)
+			assert.Equal(t, tt.wantMissing, report.Missing)
+			assert.Equal(t, tt.wantRetyped, report.Retyped)
+			assert.Equal(t, len(tt.wantNew)+len(tt.wantMissing)+len(tt.wantRetyped) > 0, report.Drifted())
+		})
+	}
+}
+
+func TestSchemaReport_String(t *testing.T) {
+	item := validItem()
+	delete(item, "brokerage")
+	item["target_from"] = 100.0
+	tracker := newSchemaTracker(recommendationSchema)
+	tracker.observe([]map[string]interface{}{validItem(), item})
+
+	assert.Equal(t,
+		"missing fields: brokerage (absent from 1 of 2 items); retyped fields: target_from (number|string)",
+		tracker.report().String())
+}
+
+func TestDriftCheck_Page(t *testing.T) {
+	drifted := validItem()
+	drifted["extra"] = true
+
+	tests := []struct {
+		mode    DriftMode
+		wantErr bool
+		tracked int
+	}{
+		{DriftWarn, false, 2},
+		{DriftFail, true, 2},
+		{DriftOff, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			check := newDriftCheck(tt.mode, "api")
+
+			require.NoError(t, check.page([]map[string]interface{}{validItem()}))
+			err := check.page([]map[string]interface{}{drifted})
+
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrSchemaDrift))
+				assert.Contains(t, err.Error(), "new fields: extra")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.tracked, check.tracker.items)
+		})
+	}
+}
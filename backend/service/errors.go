@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+// Kinds of the errors returned by the service, tested with errors.Is. The API
+// maps them to HTTP statuses, any other error is an internal one.
+var (
+	// ErrNotFound is returned by stores when the requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidInput is returned for parameters the service cannot work with
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrConflict is returned for changes clashing with the stored data
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable is returned when the database or an upstream API cannot be reached
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// kindError gives an error one of the kinds above while keeping its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// newError formats an error like fmt.Errorf, %w included, and gives it kind
+func newError(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// dbError wraps the error of a database operation, classifying unique violations
+// as ErrConflict, values Postgres cannot convert as ErrInvalidInput and lost
+// connections, timeouts and overloaded servers as ErrUnavailable
+func dbError(op string, err error) error {
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &pgErr):
+		switch {
+		case pgErr.Code == "23505":
+			return newError(ErrConflict, "%s: %w", op, err)
+		//Class 22 is data exceptions, e.g. 22P02 for an id that is not a UUID
+		case strings.HasPrefix(pgErr.Code, "22"):
+			return newError(ErrInvalidInput, "%s: %w", op, err)
+		//Class 08 is connection exceptions, 53 insufficient resources and 57P shutdowns
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"), strings.HasPrefix(pgErr.Code, "57P"):
+			return newError(ErrUnavailable, "%s: %w", op, err)
+		}
+	case pgconn.Timeout(err), errors.As(err, &netErr):
+		return newError(ErrUnavailable, "%s: %w", op, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
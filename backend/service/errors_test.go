@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewError(t *testing.T) {
+	cause := errors.New("boom")
+	err := newError(ErrInvalidInput, "bad value: %w", cause)
+
+	assert.Equal(t, "bad value: boom", err.Error())
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, ErrInvalidCursor, ErrInvalidInput)
+}
+
+func TestDBError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505"}, ErrConflict},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, ErrUnavailable},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, ErrUnavailable},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, ErrUnavailable},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrUnavailable},
+		{"invalid uuid", &pgconn.PgError{Code: "22P02"}, ErrInvalidInput},
+		{"syntax error", &pgconn.PgError{Code: "42601"}, nil},
+		{"other", errors.New("boom"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dbError("query failed", tt.err)
+			assert.Equal(t, "query failed: "+tt.err.Error(), err.Error())
+			assert.ErrorIs(t, err, tt.err)
+			for _, kind := range []error{ErrNotFound, ErrInvalidInput, ErrConflict, ErrUnavailable} {
+				assert.Equal(t, kind == tt.kind, errors.Is(err, kind), kind)
+			}
+		})
+	}
+}
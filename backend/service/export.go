@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportColumns are written in this order, with the same names -import reads,
+// so an export can be imported again without a column mapping
+var exportColumns = []string{
+	"id", "ticker", "company", "brokerage", "action", "event_type", "rating_from", "rating_to",
+	"rating_from_score", "rating_to_score", "target_from", "target_to", "time", "source",
+}
+
+// formulaColumns hold free text from the feeds, which spreadsheets would run as a
+// formula when it starts with one of formulaPrefixes
+var formulaColumns = map[string]bool{"ticker": true, "company": true, "brokerage": true, "action": true, "rating_from": true, "rating_to": true}
+
+// formulaPrefixes are the first characters of a formula, tab and carriage return included as OWASP lists them
+const formulaPrefixes = "=+-@\t\r"
+
+// exportFlushEvery is how many rows are buffered before flushing to the client
+const exportFlushEvery = 500
+
+// flusher is implemented by writers that can push buffered data out, like http.ResponseWriter
+type flusher interface {
+	Flush()
+}
+
+// ContentType returns the MIME type of the format
+func (f FileFormat) ContentType() string {
+	if f == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// ExportRecommendations streams every recommendation matching filter to w in
+// the given format and returns the number of rows written
+func ExportRecommendations(ctx context.Context, store RecommendationStore, filter RecommendationFilter, format FileFormat, w io.Writer) (int, error) {
+	var write func(values []string) error
+	var flush func() error
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return 0, fmt.Errorf("error writing CSV header: %w", err)
+		}
+		write = func(values []string) error {
+			return writer.Write(escapeFormulas(values))
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		write = func(values []string) error {
+			row := make(map[string]string, len(exportColumns))
+			for i, column := range exportColumns {
+				row[column] = values[i]
+			}
+			return encoder.Encode(row)
+		}
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	count := 0
+	err := store.StreamRecommendations(ctx, filter, func(r Recommendation) error {
+		if err := write(exportRow(r)); err != nil {
+			return fmt.Errorf("error writing row: %w", err)
+		}
+		count++
+
+		if count%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if f, ok := w.(flusher); ok {
+				f.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, flush()
+}
+
+// exportRow formats a recommendation as exportColumns, with targets written
+// the way the upstream API sends them
+func exportRow(r Recommendation) []string {
+	brokerage := ""
+	if r.Brokerage != nil {
+		brokerage = r.Brokerage.Name
+	}
+	return []string{
+		r.ID,
+		r.Company.Ticker,
+		r.Company.Name,
+		brokerage,
+		r.Action,
+		string(r.EventType),
+		r.RatingFrom,
+		r.RatingTo,
+		formatScore(r.RatingFromScore),
+		formatScore(r.RatingToScore),
+		formatTarget(r.TargetFrom, r.Currency),
+		formatTarget(r.TargetTo, r.Currency),
+		r.Time.UTC().Format(time.RFC3339),
+		r.Source,
+	}
+}
+
+// escapeFormulas prefixes the formulaColumns cells starting with a formula
+// character with ' so spreadsheets show them as text
+func escapeFormulas(values []string) []string {
+	for i, column := range exportColumns {
+		if formulaColumns[column] && values[i] != "" && strings.ContainsRune(formulaPrefixes, rune(values[i][0])) {
+			values[i] = "'" + values[i]
+		}
+	}
+	return values
+}
+
+// unescapeFormula removes the ' escapeFormulas put before a formulaColumns cell,
+// so exports are imported back as they were
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func formatScore(score *int) string {
+	if score == nil {
+		return ""
+	}
+	return strconv.Itoa(*score)
+}
+
+func formatTarget(target *float64, currency string) string {
+	if target == nil {
+		return ""
+	}
+	return FormatPrice(*target, currency)
+}
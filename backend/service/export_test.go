@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seededMemoryStore(t *testing.T) *MemoryStore {
+	store := NewMemoryStore()
+
+	first := baseRecommendationData()
+	first.TargetTo = "$200.00"
+	second := first
+	second.Ticker = "MSFT"
+	second.Company = "Microsoft"
+	second.Brokerage = ""
+	second.TargetFrom = ""
+	second.Time = first.Time.Add(-24 * time.Hour)
+
+	_, err := store.UpsertRecommendations(context.Background(), []RecommendationData{first, second}, SaveOptions{})
+	require.NoError(t, err)
+	return store
+}
+
+func TestExportRecommendations_CSV(t *testing.T) {
+	store := seededMemoryStore(t)
+	var buf bytes.Buffer
+
+	count, err := ExportRecommendations(context.Background(), store, RecommendationFilter{}, FormatCSV, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "id,ticker,company,brokerage,action,event_type,rating_from,rating_to,rating_from_score,rating_to_score,target_from,target_to,time,source", lines[0])
+	assert.Contains(t, lines[1], ",AAPL,Apple Inc.,Goldman Sachs,target raised by,target_raise,Buy,Buy,4,4,$180.00,$200.00,2025-01-10T00:30:00Z,api")
+	assert.Contains(t, lines[2], ",MSFT,Microsoft,,target raised by,target_raise,Buy,Buy,4,4,,$200.00,2025-01-09T00:30:00Z,api")
+}
+
+// formulaRecommendation has free text a spreadsheet would run as formulas
+func formulaRecommendation() RecommendationData {
+	data := baseRecommendationData()
+	data.Ticker = "+AAPL"
+	data.Company = "=HYPERLINK(\"http://example.com\")"
+	data.Brokerage = "@Research"
+	data.Action = "\tupgraded by"
+	data.RatingTo = "-Sell"
+	return data
+}
+
+func TestExportRecommendations_CSVEscapesFormulas(t *testing.T) {
+	store := NewMemoryStore()
+	_, err := store.UpsertRecommendations(context.Background(), []RecommendationData{formulaRecommendation()}, SaveOptions{})
+	require.NoError(t, err)
+
+	var csvBuf, ndjsonBuf bytes.Buffer
+	_, err = ExportRecommendations(context.Background(), store, RecommendationFilter{}, FormatCSV, &csvBuf)
+	require.NoError(t, err)
+	_, err = ExportRecommendations(context.Background(), store, RecommendationFilter{}, FormatNDJSON, &ndjsonBuf)
+	require.NoError(t, err)
+
+	assert.Contains(t, csvBuf.String(), ",'+AAPL,\"'=HYPERLINK(\"\"http://example.com\"\")\",'@Research,'\tupgraded by,")
+	assert.Contains(t, csvBuf.String(), ",Buy,'-Sell,")
+
+	//NDJSON is not opened by spreadsheets and keeps the values as they are
+	var row map[string]string
+	require.NoError(t, json.Unmarshal(ndjsonBuf.Bytes(), &row))
+	assert.Equal(t, "@Research", row["brokerage"])
+	assert.Equal(t, "-Sell", row["rating_to"])
+}
+
+func TestExportRecommendations_EscapedCellsRoundTripThroughImport(t *testing.T) {
+	store := NewMemoryStore()
+	data := formulaRecommendation()
+	_, err := store.UpsertRecommendations(context.Background(), []RecommendationData{data}, SaveOptions{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = ExportRecommendations(context.Background(), store, RecommendationFilter{}, FormatCSV, &buf)
+	require.NoError(t, err)
+
+	reader, err := newCSVRecordReader(&buf, nil)
+	require.NoError(t, err)
+	writer := newFakeWriter(SaveBatch)
+	writer.store = store
+	result, err := importRecords(reader, ImportOptions{Source: DefaultSourceName}, nil, writer)
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Unchanged: 1}, result.Saved)
+
+	require.Len(t, writer.batches, 1)
+	imported := writer.batches[0][0]
+	assert.Equal(t, data.Ticker, imported.Ticker)
+	assert.Equal(t, data.Company, imported.Company)
+	assert.Equal(t, data.Brokerage, imported.Brokerage)
+	assert.Equal(t, data.Action, imported.Action)
+	assert.Equal(t, data.RatingTo, imported.RatingTo)
+}
+
+func TestExportRecommendations_RoundTripsThroughImport(t *testing.T) {
+	store := seededMemoryStore(t)
+	var buf bytes.Buffer
+
+	_, err := ExportRecommendations(context.Background(), store, RecommendationFilter{}, FormatCSV, &buf)
+	require.NoError(t, err)
+
+	reader, err := newCSVRecordReader(&buf, nil)
+	require.NoError(t, err)
+
+	//Re-importing into the same source changes nothing
+	writer := newFakeWriter(SaveBatch)
+	writer.store = store
+	result, err := importRecords(reader, ImportOptions{Source: DefaultSourceName}, nil, writer)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, SaveResult{Unchanged: 2}, result.Saved)
+}
+
+func TestExportRecommendations_NDJSONWithFilter(t *testing.T) {
+	store := seededMemoryStore(t)
+	var buf bytes.Buffer
+
+	count, err := ExportRecommendations(context.Background(), store, RecommendationFilter{Ticker: "MSFT"}, FormatNDJSON, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	var row map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &row))
+	assert.Equal(t, "MSFT", row["ticker"])
+	assert.Equal(t, "", row["brokerage"])
+	assert.Equal(t, "api", row["source"])
+}
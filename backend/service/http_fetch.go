@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how upstream requests are retried
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry, doubled on every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff and the Retry-After a server may ask
+	// for; the attempt fails when the server asks for longer
+	MaxDelay time.Duration
+	// Timeout bounds every single request, including reading the body
+	Timeout time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 5,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+		Timeout:    30 * time.Second,
+	}
+}
+
+// LoadRetryPolicy reads FETCH_MAX_RETRIES, FETCH_BASE_DELAY, FETCH_MAX_DELAY and
+// FETCH_TIMEOUT from the environment, falling back to DefaultRetryPolicy
+func LoadRetryPolicy() (RetryPolicy, error) {
+	policy := DefaultRetryPolicy()
+
+	if value := os.Getenv("FETCH_MAX_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			return policy, fmt.Errorf("invalid FETCH_MAX_RETRIES %q: expected a non-negative integer", value)
+		}
+		policy.MaxRetries = retries
+	}
+
+	durations := []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"FETCH_BASE_DELAY", &policy.BaseDelay},
+		{"FETCH_MAX_DELAY", &policy.MaxDelay},
+		{"FETCH_TIMEOUT", &policy.Timeout},
+	}
+	for _, d := range durations {
+		value := os.Getenv(d.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return policy, fmt.Errorf("invalid %s %q: expected a positive duration like 500ms or 30s", d.key, value)
+		}
+		*d.target = parsed
+	}
+	return policy, nil
+}
+
+// HTTPStatusError is returned when the upstream answers with a non-200 status
+type HTTPStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// Retryable reports whether the status is worth retrying: rate limits and server errors
+func (e *HTTPStatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Fetcher performs GET requests with per-request timeouts, retries with
+// exponential backoff and jitter, and honors Retry-After on 429 and 503
+type Fetcher struct {
+	client *http.Client
+	policy RetryPolicy
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func() float64
+}
+
+func NewFetcher(policy RetryPolicy) *Fetcher {
+	return &Fetcher{
+		client: &http.Client{Timeout: policy.Timeout},
+		policy: policy,
+		sleep:  sleepContext,
+		jitter: rand.Float64,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Get returns the body of a successful response, retrying transient failures
+func (f *Fetcher) Get(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= f.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := f.backoff(attempt, lastErr)
+			if err := f.sleep(ctx, delay); err != nil {
+				return nil, fmt.Errorf("retry aborted: %w (last error: %v)", err, lastErr)
+			}
+		}
+
+		body, err := f.do(ctx, url, header)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) && !statusErr.Retryable() {
+			return nil, err
+		}
+		//Waiting longer would stall the sync, and hold the sync lock, for as long as the server likes
+		if statusErr != nil && statusErr.RetryAfter > f.policy.MaxDelay {
+			return nil, newError(ErrUnavailable, "server asked to retry after %s, longer than the %s maximum: %w", statusErr.RetryAfter, f.policy.MaxDelay, err)
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if attempt < f.policy.MaxRetries {
+			fmt.Printf("⚠️  Request failed (%v), retrying (%d/%d)\n", err, attempt+1, f.policy.MaxRetries)
+		}
+	}
+	return nil, newError(ErrUnavailable, "giving up after %d attempts: %w", f.policy.MaxRetries+1, lastErr)
+}
+
+func (f *Fetcher) do(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		//Drain so the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		statusErr := &HTTPStatusError{StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, statusErr
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	return body, nil
+}
+
+// backoff returns the wait before the given retry: the server's Retry-After when
+// present, otherwise half of the capped exponential delay plus a random jitter.
+// Both are capped at MaxDelay.
+func (f *Fetcher) backoff(attempt int, lastErr error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(lastErr, &statusErr) && statusErr.RetryAfter > 0 {
+		return min(statusErr.RetryAfter, f.policy.MaxDelay)
+	}
+
+	delay := float64(f.policy.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if delay > float64(f.policy.MaxDelay) {
+		delay = float64(f.policy.MaxDelay)
+	}
+	return time.Duration(delay/2 + f.jitter()*delay/2)
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
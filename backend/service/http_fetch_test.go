@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFetcher records the backoff delays instead of sleeping
+func newTestFetcher(policy RetryPolicy) (*Fetcher, *[]time.Duration) {
+	var delays []time.Duration
+	fetcher := NewFetcher(policy)
+	fetcher.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	fetcher.jitter = func() float64 { return 1 }
+	return fetcher, &delays
+}
+
+func TestFetcher_RetriesTransientFailures(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	fetcher, delays := newTestFetcher(RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Timeout: time.Second})
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+
+	body, err := fetcher.Get(context.Background(), srv.URL, header)
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"items":[]}`, string(body))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{time.Second, 7 * time.Second}, *delays)
+}
+
+func TestFetcher_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	fetcher, _ := newTestFetcher(RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Timeout: time.Second})
+
+	_, err := fetcher.Get(context.Background(), srv.URL, nil)
+
+	var statusErr *HTTPStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestFetcher_RejectsLongRetryAfter(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	fetcher, delays := newTestFetcher(RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Timeout: time.Second})
+
+	_, err := fetcher.Get(context.Background(), srv.URL, nil)
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Contains(t, err.Error(), "retry after 24h0m0s")
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, *delays)
+}
+
+func TestFetcher_GivesUpWithExponentialBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	fetcher, delays := newTestFetcher(RetryPolicy{MaxRetries: 4, BaseDelay: time.Second, MaxDelay: 5 * time.Second, Timeout: time.Second})
+
+	_, err := fetcher.Get(context.Background(), srv.URL, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "giving up after 5 attempts")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}, *delays)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "Seconds", value: "120", expected: 2 * time.Minute},
+		{name: "HTTP date", value: "Wed, 01 Jan 2025 12:00:30 GMT", expected: 30 * time.Second},
+		{name: "Date in the past", value: "Wed, 01 Jan 2025 11:00:00 GMT", expected: 0},
+		{name: "Empty", value: "", expected: 0},
+		{name: "Garbage", value: "soon", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseRetryAfter(tt.value, now))
+		})
+	}
+}
+
+func TestSyncResult_Status(t *testing.T) {
+	var complete SyncResult
+	complete.finish(nil)
+	assert.Equal(t, SyncComplete, complete.Status)
+
+	partial := SyncResult{Saved: SaveResult{Inserted: 10}}
+	partial.finish(errors.New("upstream unavailable"))
+	assert.Equal(t, SyncPartial, partial.Status)
+
+	var failed SyncResult
+	failed.finish(errors.New("upstream unavailable"))
+	assert.Equal(t, SyncFailed, failed.Status)
+}
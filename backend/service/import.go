@@ -0,0 +1,398 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ImportSourceName is recorded as the source of imported recommendations
+// unless the import names another one
+const ImportSourceName = "import"
+
+// FileFormat is the file layout read by -import and written by -export
+type FileFormat string
+
+const (
+	// FormatCSV is a comma separated file with a header row
+	FormatCSV FileFormat = "csv"
+	// FormatNDJSON is one JSON object per line
+	FormatNDJSON FileFormat = "ndjson"
+)
+
+// recommendationFields are the item keys understood by convertRecommendationData
+var recommendationFields = []string{
+	"ticker", "target_from", "target_to", "company", "action",
+	"brokerage", "rating_from", "rating_to", "time",
+}
+
+// ColumnMapping maps recommendation fields to the column (CSV) or key (NDJSON)
+// holding them in the file. Unmapped fields are read from a column of the same name.
+type ColumnMapping map[string]string
+
+// ParseColumnMapping parses a mapping such as "ticker=Symbol,time=Date"
+func ParseColumnMapping(spec string) (ColumnMapping, error) {
+	mapping := ColumnMapping{}
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+
+	known := map[string]bool{}
+	for _, field := range recommendationFields {
+		known[field] = true
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		column = strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid column mapping %q: expected field=column", pair)
+		}
+		if !known[field] {
+			return nil, fmt.Errorf("unknown field %q in column mapping (expected one of %s)", field, strings.Join(recommendationFields, ", "))
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// column returns the file column holding field
+func (m ColumnMapping) column(field string) string {
+	if column, ok := m[field]; ok {
+		return column
+	}
+	return field
+}
+
+// apply renames the columns of a raw record to recommendation fields. Scalar
+// values are turned into strings so numeric NDJSON values are not lost.
+func (m ColumnMapping) apply(record map[string]interface{}) map[string]interface{} {
+	item := make(map[string]interface{}, len(recommendationFields))
+	for _, field := range recommendationFields {
+		value, ok := record[m.column(field)]
+		if !ok || value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			item[field] = v
+		case json.Number, bool, float64:
+			item[field] = fmt.Sprint(v)
+		}
+	}
+	return item
+}
+
+// ImportOptions configures an -import run
+type ImportOptions struct {
+	Path string
+	// Format is detected from the file extension when empty
+	Format  FileFormat
+	Mapping ColumnMapping
+	// Source defaults to ImportSourceName
+	Source string
+	Save   SaveOptions
+}
+
+// LineError is a line of the file that could not be imported
+type LineError struct {
+	Line int
+	Err  error
+	// Raw is the text of the line when the reader has it
+	Raw string
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Lines  int
+	Saved  SaveResult
+	Errors []LineError
+}
+
+// syncResult reports the import like a sync run, for the ingest_run audit log
+func (r ImportResult) syncResult(err error) SyncResult {
+	result := SyncResult{Items: r.Lines, Rejected: len(r.Errors), Saved: r.Saved}
+	result.finish(err)
+	return result
+}
+
+func (r ImportResult) String() string {
+	return fmt.Sprintf("%d lines, %d rejected (%s)", r.Lines, len(r.Errors), r.Saved)
+}
+
+// DetectFileFormat picks the format from the file extension
+func DetectFileFormat(path string) (FileFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("cannot detect the format of %s, set the format to csv or ndjson", path)
+}
+
+// ParseFileFormat validates a csv or ndjson format name
+func ParseFileFormat(value string) (FileFormat, error) {
+	switch FileFormat(value) {
+	case FormatCSV, FormatNDJSON:
+		return FileFormat(value), nil
+	}
+	return "", newError(ErrInvalidInput, "unknown format %q (expected csv or ndjson)", value)
+}
+
+// ImportFile streams a CSV or NDJSON file into the database through the same
+// save path as -fetch. Lines that fail to parse or convert are reported in the
+// result and skipped; only I/O and database errors abort the import.
+func ImportFile(opts ImportOptions) (ImportResult, error) {
+	format := opts.Format
+	if format == "" {
+		detected, err := DetectFileFormat(opts.Path)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		format = detected
+	}
+
+	file, err := os.Open(opts.Path)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("error opening import file: %w", err)
+	}
+	defer file.Close()
+
+	var reader recordReader
+	switch format {
+	case FormatCSV:
+		reader, err = newCSVRecordReader(file, opts.Mapping)
+	case FormatNDJSON:
+		reader = newNDJSONRecordReader(file)
+	default:
+		err = fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	source := opts.Source
+	if source == "" {
+		source = ImportSourceName
+	}
+	unlock, err := lockSync()
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer unlock()
+
+	run := startIngestRun(IngestImport, source)
+	opts.Save.OnBatchError = run.deadLetterBatch
+
+	result, err := importRecords(reader, opts, run, newRecommendationWriter(opts.Save))
+	run.finish(result.syncResult(err))
+	return result, err
+}
+
+// importRecords converts the records of reader and saves them in batches
+// through writer, rejected lines are dead lettered through run. The writer is
+// finished once, so in SaveAtomic mode a failure keeps none of the batches.
+func importRecords(reader recordReader, opts ImportOptions, run *ingestRecorder, writer recommendationWriter) (ImportResult, error) {
+	var result ImportResult
+	ctx := context.Background()
+
+	source := opts.Source
+	if source == "" {
+		source = ImportSourceName
+	}
+	batchSize := opts.Save.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	reject := func(line int, err error) {
+		lineErr := LineError{Line: line, Err: err}
+		log.Printf("⚠️  Skipping %v", lineErr)
+		result.Errors = append(result.Errors, lineErr)
+	}
+
+	batch := make([]RecommendationData, 0, batchSize)
+	var progress SaveResult
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		saved, err := writer.save(ctx, batch)
+		progress.Add(saved)
+		if err != nil {
+			return fmt.Errorf("error saving recommendations: %w", err)
+		}
+		fmt.Printf("💾 Imported %d lines so far (%s)\n", result.Lines, progress)
+		batch = batch[:0]
+		return nil
+	}
+
+	load := func() error {
+		for {
+			line, record, err := reader.Next()
+			if err == io.EOF {
+				return flush()
+			}
+			var lineErr *LineError
+			if errors.As(err, &lineErr) {
+				result.Lines++
+				reject(lineErr.Line, lineErr.Err)
+				run.deadLetter(source, StageRead, map[string]interface{}{"file": opts.Path, "line": lineErr.Line, "raw": lineErr.Raw}, lineErr.Err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			result.Lines++
+
+			item := opts.Mapping.apply(record)
+			rec, err := convertRecommendationData(item)
+			if err != nil {
+				reject(line, err)
+				run.deadLetter(source, StageConvert, item, err)
+				continue
+			}
+			rec.Source = source
+			batch = append(batch, rec)
+
+			if len(batch) == batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	err := load()
+	saved, finishErr := writer.finish(ctx, err)
+	result.Saved = saved
+	if err == nil {
+		err = finishErr
+	}
+	return result, err
+}
+
+// recordReader yields the raw records of an import file one at a time. Next
+// returns io.EOF at the end, a *LineError for a malformed line that can be
+// skipped, and any other error when reading cannot continue.
+type recordReader interface {
+	Next() (line int, record map[string]interface{}, err error)
+}
+
+type csvRecordReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVRecordReader(r io.Reader, mapping ColumnMapping) (*csvRecordReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	columns := map[string]bool{}
+	names := make([]string, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		names[i] = name
+		columns[name] = true
+	}
+
+	//Explicitly mapped columns must exist, otherwise every line would be rejected
+	var missing []string
+	for field, column := range mapping {
+		if !columns[column] {
+			missing = append(missing, fmt.Sprintf("%s (for %s)", column, field))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("CSV header is missing mapped columns: %s", strings.Join(missing, ", "))
+	}
+
+	return &csvRecordReader{reader: reader, header: names}, nil
+}
+
+func (c *csvRecordReader) Next() (int, map[string]interface{}, error) {
+	fields, err := c.reader.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, &LineError{Line: parseErr.StartLine, Err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	record := make(map[string]interface{}, len(c.header))
+	for i, name := range c.header {
+		if formulaColumns[name] {
+			record[name] = unescapeFormula(fields[i])
+		} else {
+			record[name] = fields[i]
+		}
+	}
+	return line, record, nil
+}
+
+// maxNDJSONLine bounds the length of a single NDJSON line
+const maxNDJSONLine = 1024 * 1024
+
+type ndjsonRecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONRecordReader(r io.Reader) *ndjsonRecordReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+	return &ndjsonRecordReader{scanner: scanner}
+}
+
+func (n *ndjsonRecordReader) Next() (int, map[string]interface{}, error) {
+	for n.scanner.Scan() {
+		n.line++
+		text := bytes.TrimSpace(n.scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return n.line, nil, &LineError{Line: n.line, Err: fmt.Errorf("invalid JSON: %w", err), Raw: string(text)}
+		}
+		return n.line, record, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		return 0, nil, fmt.Errorf("error reading NDJSON after line %d: %w", n.line, err)
+	}
+	return 0, nil, io.EOF
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := ParseColumnMapping(" ticker = Symbol ,time=Date")
+	require.NoError(t, err)
+	assert.Equal(t, ColumnMapping{"ticker": "Symbol", "time": "Date"}, mapping)
+	assert.Equal(t, "Symbol", mapping.column("ticker"))
+	assert.Equal(t, "brokerage", mapping.column("brokerage"))
+
+	empty, err := ParseColumnMapping("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	for _, spec := range []string{"ticker", "ticker=", "price=Close"} {
+		_, err := ParseColumnMapping(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestImportRecords_CSV(t *testing.T) {
+	file := strings.Join([]string{
+		"Symbol,Firm,action,rating_from,rating_to,target_from,target_to,Date",
+		"AAPL,Goldman Sachs,target raised by,Buy,Buy,$180.00,$200.00,2025-01-10T00:30:00Z",
+		"MSFT,Morgan Stanley,upgraded by,Hold,Buy,,,not-a-date",
+		"NVDA,Jefferies,initiated by",
+		`TSLA,"Wedbush",reiterated by,Outperform,Outperform,$300.00,$350.00,2025-01-11T10:00:00Z`,
+	}, "\n")
+
+	mapping := ColumnMapping{"ticker": "Symbol", "brokerage": "Firm", "time": "Date"}
+	reader, err := newCSVRecordReader(strings.NewReader(file), mapping)
+	require.NoError(t, err)
+
+	writer := newFakeWriter(SaveBatch)
+	result, err := importRecords(reader, ImportOptions{Mapping: mapping, Save: SaveOptions{BatchSize: 1}}, nil, writer)
+	require.NoError(t, err)
+	batches := writer.batches
+
+	assert.Equal(t, 4, result.Lines)
+	assert.Equal(t, 2, result.Saved.Inserted)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, 3, result.Errors[0].Line)
+	assert.Contains(t, result.Errors[0].Error(), "failed to parse time")
+	assert.Equal(t, 4, result.Errors[1].Line)
+
+	require.Len(t, batches, 2)
+	first := batches[0][0]
+	assert.Equal(t, "AAPL", first.Ticker)
+	assert.Equal(t, "Goldman Sachs", first.Brokerage)
+	assert.Equal(t, "$200.00", first.TargetTo)
+	assert.Equal(t, ImportSourceName, first.Source)
+	assert.Equal(t, time.Date(2025, 1, 10, 0, 30, 0, 0, time.UTC), first.Time)
+	assert.Equal(t, "Wedbush", batches[1][0].Brokerage)
+}
+
+func TestNewCSVRecordReader_MissingMappedColumn(t *testing.T) {
+	_, err := newCSVRecordReader(strings.NewReader("ticker,time\n"), ColumnMapping{"brokerage": "Firm"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Firm (for brokerage)")
+}
+
+func TestImportRecords_NDJSON(t *testing.T) {
+	file := strings.Join([]string{
+		`{"ticker":"AAPL","brokerage":"Goldman Sachs","action":"target raised by","target_to":"$200.00","time":"2025-01-10T00:30:00Z"}`,
+		``,
+		`{"ticker":"MSFT",`,
+		`{"ticker":"NVDA","time":"2025-01-11T10:00:00Z","price":912.5}`,
+	}, "\n")
+
+	writer := newFakeWriter(SaveBatch)
+	result, err := importRecords(newNDJSONRecordReader(strings.NewReader(file)),
+		ImportOptions{Source: "vendor", Mapping: ColumnMapping{"target_from": "price"}}, nil, writer)
+	require.NoError(t, err)
+	batches := writer.batches
+
+	assert.Equal(t, 3, result.Lines)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, 3, result.Errors[0].Line)
+
+	require.Len(t, batches, 1, "a single batch when everything fits in the batch size")
+	require.Len(t, batches[0], 2)
+	assert.Equal(t, "vendor", batches[0][0].Source)
+	assert.Equal(t, "912.5", batches[0][1].TargetFrom, "numeric values are kept as text")
+}
+
+func TestImportRecords_SaveErrorAborts(t *testing.T) {
+	file := "ticker,time\nAAPL,2025-01-10T00:30:00Z\n"
+	reader, err := newCSVRecordReader(strings.NewReader(file), nil)
+	require.NoError(t, err)
+
+	writer := newFakeWriter(SaveBatch)
+	writer.failAt = 1
+	_, err = importRecords(reader, ImportOptions{}, nil, writer)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+	assert.Equal(t, 1, writer.finished)
+}
+
+func TestImportRecords_AtomicKeepsNothingOnFailure(t *testing.T) {
+	file := "ticker,time\nAAPL,2025-01-10T00:30:00Z\nMSFT,2025-01-10T00:30:00Z\nNVDA,2025-01-10T00:30:00Z\n"
+
+	tests := []struct {
+		mode   SaveMode
+		stored int
+	}{
+		{mode: SaveAtomic, stored: 0},
+		{mode: SaveBatch, stored: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			reader, err := newCSVRecordReader(strings.NewReader(file), nil)
+			require.NoError(t, err)
+
+			//The second batch fails after the first one was saved
+			writer := newFakeWriter(tt.mode)
+			writer.failAt = 2
+			result, err := importRecords(reader, ImportOptions{Save: SaveOptions{Mode: tt.mode, BatchSize: 1}}, nil, writer)
+			require.Error(t, err)
+
+			assert.Len(t, writer.batches, 2, "the import stops at the first failure")
+			assert.Equal(t, 1, writer.finished)
+			assert.Len(t, writer.stored(t), tt.stored)
+			assert.Equal(t, tt.stored, result.Saved.Inserted)
+		})
+	}
+}
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected FileFormat
+		wantErr  bool
+	}{
+		{path: "dump.csv", expected: FormatCSV},
+		{path: "dump.NDJSON", expected: FormatNDJSON},
+		{path: "dump.jsonl", expected: FormatNDJSON},
+		{path: "dump.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			format, err := DetectFileFormat(tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"stock-investment-backend/connection"
+	"time"
+)
+
+// IngestKind is the command that started an ingest run
+type IngestKind string
+
+const (
+	IngestFetch     IngestKind = "fetch"
+	IngestImport    IngestKind = "import"
+	IngestReprocess IngestKind = "reprocess"
+	IngestReplay    IngestKind = "replay"
+)
+
+// DeadLetterStage is the step of ingestion that rejected an item
+type DeadLetterStage string
+
+const (
+	// StageRead is a line of an import file that could not be parsed, it cannot be reprocessed
+	StageRead DeadLetterStage = "read"
+	// StageConvert is a raw item rejected by the source's conversion
+	StageConvert DeadLetterStage = "convert"
+	// StageSave is a converted recommendation whose batch failed to save
+	StageSave DeadLetterStage = "save"
+)
+
+// IngestRun is the audit record of a -fetch, -import, -reprocess-failed or -replay run
+type IngestRun struct {
+	ID          string     `json:"id"`
+	Kind        IngestKind `json:"kind"`
+	Source      string     `json:"source"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Pages       int        `json:"pages"`
+	ItemsSeen   int        `json:"items_seen"`
+	Inserted    int        `json:"inserted"`
+	Updated     int        `json:"updated"`
+	Unchanged   int        `json:"unchanged"`
+	Skipped     int        `json:"skipped"`
+	Failed      int        `json:"failed"`
+	Status      SyncStatus `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	DeadLetters int        `json:"dead_letters"`
+}
+
+// apply copies the counters of a finished run
+func (r *IngestRun) apply(result SyncResult) {
+	r.Pages = result.Pages
+	r.ItemsSeen = result.Items
+	r.Inserted = result.Saved.Inserted
+	r.Updated = result.Saved.Updated
+	r.Unchanged = result.Saved.Unchanged
+	r.Skipped = result.Skipped
+	r.Failed = result.Saved.Failed + result.Rejected
+	r.Status = result.Status
+	r.Error = ""
+	if result.Err != nil {
+		r.Error = result.Err.Error()
+	}
+}
+
+// ingestRecorder writes the audit row and dead letters of one run. A nil
+// recorder records nothing, so ingestion keeps working when the audit tables
+// are missing.
+type ingestRecorder struct {
+	id string
+}
+
+// startIngestRun inserts the audit row of a new run
+func startIngestRun(kind IngestKind, source string) *ingestRecorder {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		log.Printf("⚠️  Ingest run not recorded: %v", err)
+		return nil
+	}
+	defer conn.CloseConn(context.Background())
+
+	var id string
+	err = conn.QueryRow(context.Background(),
+		"INSERT INTO ingest_run (kind, source) VALUES ($1, $2) RETURNING id",
+		string(kind), source).Scan(&id)
+	if err != nil {
+		log.Printf("⚠️  Ingest run not recorded: %v", err)
+		return nil
+	}
+	return &ingestRecorder{id: id}
+}
+
+// deadLetter stores a rejected raw item
+func (r *ingestRecorder) deadLetter(source string, stage DeadLetterStage, payload interface{}, err error) {
+	r.deadLetters(source, stage, []interface{}{payload}, err)
+}
+
+// deadLetterBatch stores the recommendations of a batch that failed to save,
+// it is used as SaveOptions.OnBatchError
+func (r *ingestRecorder) deadLetterBatch(batch []RecommendationData, err error) {
+	if r == nil || len(batch) == 0 {
+		return
+	}
+	payloads := make([]interface{}, len(batch))
+	for i, rec := range batch {
+		payloads[i] = rec
+	}
+	r.deadLetters(batch[0].sourceName(), StageSave, payloads, err)
+}
+
+func (r *ingestRecorder) deadLetters(source string, stage DeadLetterStage, payloads []interface{}, cause error) {
+	if r == nil {
+		return
+	}
+	encoded := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("⚠️  Dead letter not recorded: %v", err)
+			continue
+		}
+		encoded = append(encoded, string(data))
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		log.Printf("⚠️  Dead letters not recorded: %v", err)
+		return
+	}
+	defer conn.CloseConn(context.Background())
+
+	_, err = conn.Exec(context.Background(), `
+		INSERT INTO ingest_dead_letter (run_id, source, stage, payload, error)
+		SELECT $1, $2, $3, p::jsonb, $5 FROM unnest($4::text[]) AS p`,
+		r.id, source, string(stage), encoded, cause.Error())
+	if err != nil {
+		log.Printf("⚠️  Dead letters not recorded: %v", err)
+	}
+}
+
+// finish stores the outcome of the run
+func (r *ingestRecorder) finish(result SyncResult) {
+	if r == nil {
+		return
+	}
+	var run IngestRun
+	run.apply(result)
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		log.Printf("⚠️  Ingest run %s not finished: %v", r.id, err)
+		return
+	}
+	defer conn.CloseConn(context.Background())
+
+	_, err = conn.Exec(context.Background(), `
+		UPDATE ingest_run SET finished_at = now(), pages = $2, items_seen = $3, inserted = $4,
+			updated = $5, unchanged = $6, skipped = $7, failed = $8, status = $9, error = NULLIF($10, '')
+		WHERE id = $1`,
+		r.id, run.Pages, run.ItemsSeen, run.Inserted, run.Updated, run.Unchanged,
+		run.Skipped, run.Failed, string(run.Status), run.Error)
+	if err != nil {
+		log.Printf("⚠️  Ingest run %s not finished: %v", r.id, err)
+	}
+}
+
+func (s *PostgresStore) ListIngestRuns(ctx context.Context, limit, offset int) ([]IngestRun, int, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, 0, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	var total int
+	if err := conn.QueryRow(ctx, "SELECT COUNT(*) FROM ingest_run").Scan(&total); err != nil {
+		return nil, 0, dbError("count query failed", err)
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT r.id, r.kind, r.source, r.started_at, r.finished_at, r.pages, r.items_seen,
+			r.inserted, r.updated, r.unchanged, r.skipped, r.failed, r.status, COALESCE(r.error, ''),
+			(SELECT COUNT(*) FROM ingest_dead_letter d WHERE d.run_id = r.id)
+		FROM ingest_run r
+		ORDER BY r.started_at DESC
+		LIMIT $1 OFFSET $2`,
+		limit, offset)
+	if err != nil {
+		return nil, 0, dbError("query failed", err)
+	}
+	defer rows.Close()
+
+	var runs []IngestRun
+	for rows.Next() {
+		var r IngestRun
+		err := rows.Scan(&r.ID, &r.Kind, &r.Source, &r.StartedAt, &r.FinishedAt, &r.Pages, &r.ItemsSeen,
+			&r.Inserted, &r.Updated, &r.Unchanged, &r.Skipped, &r.Failed, &r.Status, &r.Error, &r.DeadLetters)
+		if err != nil {
+			return nil, 0, dbError("scan failed", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, total, rows.Err()
+}
+
+// ReprocessOptions configures a -reprocess-failed run
+type ReprocessOptions struct {
+	// Source limits the run to the dead letters of one source, all of them when empty
+	Source string
+	Save   SaveOptions
+}
+
+// deadLetterRecord is a pending dead letter loaded for reprocessing
+type deadLetterRecord struct {
+	id      string
+	source  string
+	stage   DeadLetterStage
+	payload []byte
+}
+
+// decode turns the payload back into a recommendation. Raw items are
+// converted with the canonical field names every source and -import use.
+func (d deadLetterRecord) decode() (RecommendationData, error) {
+	var rec RecommendationData
+	switch d.stage {
+	case StageSave:
+		if err := json.Unmarshal(d.payload, &rec); err != nil {
+			return rec, fmt.Errorf("invalid payload: %w", err)
+		}
+	case StageConvert:
+		var item map[string]interface{}
+		if err := json.Unmarshal(d.payload, &item); err != nil {
+			return rec, fmt.Errorf("invalid payload: %w", err)
+		}
+		converted, err := convertRecommendationData(item)
+		if err != nil {
+			return rec, err
+		}
+		rec = converted
+	default:
+		return rec, fmt.Errorf("dead letters of stage %q cannot be reprocessed", d.stage)
+	}
+	rec.Source = d.source
+	return rec, nil
+}
+
+// loadDeadLetters returns the pending dead letters of source, of every source when empty
+func loadDeadLetters(ctx context.Context, source string) ([]deadLetterRecord, error) {
+	var letters []deadLetterRecord
+	err := withConnection(func(conn connection.DBConnection) error {
+		rows, err := conn.Query(ctx, `
+			SELECT id, source, stage, payload::text
+			FROM ingest_dead_letter
+			WHERE reprocessed_at IS NULL AND stage <> $1 AND ($2 = '' OR source = $2)
+			ORDER BY created_at`,
+			string(StageRead), source)
+		if err != nil {
+			return fmt.Errorf("query failed: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var d deadLetterRecord
+			var payload string
+			if err := rows.Scan(&d.id, &d.source, &d.stage, &payload); err != nil {
+				return fmt.Errorf("scan failed: %w", err)
+			}
+			d.payload = []byte(payload)
+			letters = append(letters, d)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("query failed: %w", err)
+		}
+		return nil
+	})
+	return letters, err
+}
+
+// ReprocessFailed retries the pending dead letters. Saved ones are marked as
+// reprocessed, the others keep their latest error for the next attempt. Like
+// syncs it fails with ErrSyncLocked while another one is running.
+func ReprocessFailed(opts ReprocessOptions) (SyncResult, error) {
+	unlock, err := lockSync()
+	if err != nil {
+		return notStarted(err), err
+	}
+	defer unlock()
+
+	var result SyncResult
+
+	//The connection is released before saving, which takes connections of its own
+	ctx := context.Background()
+	letters, err := loadDeadLetters(ctx, opts.Source)
+	if err != nil {
+		return result, err
+	}
+
+	if len(letters) == 0 {
+		result.finish(nil)
+		return result, nil
+	}
+
+	source := opts.Source
+	if source == "" {
+		source = "all"
+	}
+	run := startIngestRun(IngestReprocess, source)
+	result.Items = len(letters)
+
+	//Errors by dead letter id, a letter with no error was saved
+	errs := make(map[string]string, len(letters))
+	ids := make(map[string][]string, len(letters))
+	recommendations := make([]RecommendationData, 0, len(letters))
+	for _, d := range letters {
+		rec, err := d.decode()
+		if err != nil {
+			errs[d.id] = err.Error()
+			result.Rejected++
+			continue
+		}
+		key := rec.sourceName() + "/" + rec.Fingerprint()
+		ids[key] = append(ids[key], d.id)
+		recommendations = append(recommendations, rec)
+	}
+
+	//Failed batches stay in the dead letter table instead of being added again
+	failBatch := func(batch []RecommendationData, err error) {
+		for _, rec := range batch {
+			for _, id := range ids[rec.sourceName()+"/"+rec.Fingerprint()] {
+				errs[id] = err.Error()
+			}
+		}
+	}
+	opts.Save.OnBatchError = failBatch
+	saved, saveErr := SaveRecommendations(recommendations, opts.Save)
+	result.Saved = saved
+	if saveErr != nil {
+		failBatch(recommendations, saveErr)
+	}
+
+	letterIDs := make([]string, len(letters))
+	letterErrors := make([]*string, len(letters))
+	for i, d := range letters {
+		letterIDs[i] = d.id
+		if msg, ok := errs[d.id]; ok {
+			letterErrors[i] = &msg
+		}
+	}
+	err = withConnection(func(conn connection.DBConnection) error {
+		_, err := conn.Exec(ctx, `
+			UPDATE ingest_dead_letter dl
+			SET attempts = dl.attempts + 1, error = COALESCE(r.error, dl.error),
+				reprocessed_at = CASE WHEN r.error IS NULL THEN now() END
+			FROM unnest($1::uuid[], $2::text[]) AS r(id, error)
+			WHERE dl.id = r.id`,
+			letterIDs, letterErrors)
+		return err
+	})
+	if err != nil && saveErr == nil {
+		saveErr = fmt.Errorf("failed to update dead letters: %w", err)
+	}
+
+	result.finish(saveErr)
+	run.finish(result)
+	return result, saveErr
+}
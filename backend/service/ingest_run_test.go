@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterRecord_Decode(t *testing.T) {
+	data := baseRecommendationData()
+	saved, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	rec, err := deadLetterRecord{source: "vendor", stage: StageSave, payload: saved}.decode()
+	require.NoError(t, err)
+	assert.Equal(t, data.Fingerprint(), rec.Fingerprint())
+	assert.Equal(t, "vendor", rec.Source)
+
+	raw := []byte(`{"ticker": "AAPL", "company": "Apple Inc.", "action": "upgraded by", "time": "2025-01-10T00:30:00Z"}`)
+	rec, err = deadLetterRecord{source: "api", stage: StageConvert, payload: raw}.decode()
+	require.NoError(t, err)
+	assert.Equal(t, "AAPL", rec.Ticker)
+	assert.Equal(t, "api", rec.Source)
+
+	_, err = deadLetterRecord{source: "api", stage: StageConvert, payload: []byte(`{"ticker": "AAPL"}`)}.decode()
+	assert.EqualError(t, err, "time is required")
+
+	_, err = deadLetterRecord{source: "import", stage: StageRead, payload: []byte(`{"line": 3}`)}.decode()
+	assert.Error(t, err)
+}
+
+func TestIngestRun_Apply(t *testing.T) {
+	result := SyncResult{
+		Pages:    3,
+		Items:    120,
+		Skipped:  10,
+		Rejected: 2,
+		Saved:    SaveResult{Inserted: 90, Updated: 5, Unchanged: 8, Failed: 5},
+	}
+	result.finish(errors.New("page 4: unexpected status code 502"))
+
+	var run IngestRun
+	run.apply(result)
+	assert.Equal(t, IngestRun{
+		Pages:     3,
+		ItemsSeen: 120,
+		Inserted:  90,
+		Updated:   5,
+		Unchanged: 8,
+		Skipped:   10,
+		Failed:    7,
+		Status:    SyncPartial,
+		Error:     "page 4: unexpected status code 502",
+	}, run)
+}
+
+func TestImportResult_SyncResult(t *testing.T) {
+	result := ImportResult{
+		Lines:  4,
+		Saved:  SaveResult{Inserted: 2},
+		Errors: []LineError{{Line: 3, Err: errors.New("time is required")}},
+	}.syncResult(nil)
+
+	assert.Equal(t, SyncComplete, result.Status)
+	assert.Equal(t, 4, result.Items)
+	assert.Equal(t, 1, result.Rejected)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"stock-investment-backend/connection"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// pageBuffer bounds how many fetched pages wait for the writer, so memory
+// does not grow with the size of the dataset
+const pageBuffer = 2
+
+// fetchedPage is a page read by fetchPages, or the error that stopped it
+type fetchedPage struct {
+	token string
+	page  *SourcePage
+	err   error
+}
+
+// fetchPages reads the pages of src from token on in a goroutine. The
+// channel is closed after the last page, after an error or when ctx is done.
+func fetchPages(ctx context.Context, src Source, token string) <-chan fetchedPage {
+	pages := make(chan fetchedPage, pageBuffer)
+	go func() {
+		defer close(pages)
+		for {
+			page, err := src.FetchPage(ctx, token)
+			select {
+			case pages <- fetchedPage{token: token, page: page, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil || page.NextPage == "" {
+				return
+			}
+			token = page.NextPage
+		}
+	}()
+	return pages
+}
+
+// convertPage converts the items of a page, dead lettering the ones src rejects
+func convertPage(src Source, page *SourcePage, run *ingestRecorder, result *SyncResult) []RecommendationData {
+	recommendations := make([]RecommendationData, 0, len(page.Items))
+	for i, item := range page.Items {
+		rec, err := src.Convert(item)
+		if err != nil {
+			log.Printf("Error converting recommendation data %d: %v", i, err)
+			result.Rejected++
+			run.deadLetter(src.Name(), StageConvert, item, err)
+			continue
+		}
+		recommendations = append(recommendations, rec)
+	}
+	return recommendations
+}
+
+// recommendationWriter saves the pages or batches of one load as they arrive,
+// finish ends the load and returns its totals
+type recommendationWriter interface {
+	save(ctx context.Context, recommendations []RecommendationData) (SaveResult, error)
+	finish(ctx context.Context, err error) (SaveResult, error)
+}
+
+// newRecommendationWriter returns the writer of a load, a pageWriter outside tests
+var newRecommendationWriter = func(opts SaveOptions) recommendationWriter {
+	return newPageWriter(opts)
+}
+
+// pageWriter saves the pages of a sync as they arrive. In SaveBatch mode each
+// page is committed on its own, so progress survives a late failure; in
+// SaveAtomic mode every page joins one transaction committed by finish.
+type pageWriter struct {
+	opts    SaveOptions
+	conn    connection.DBConnection
+	tx      pgx.Tx
+	saved   SaveResult
+	pending SaveResult
+}
+
+func newPageWriter(opts SaveOptions) *pageWriter {
+	return &pageWriter{opts: opts}
+}
+
+// save persists one page and returns what it changed
+func (w *pageWriter) save(ctx context.Context, recommendations []RecommendationData) (SaveResult, error) {
+	if len(recommendations) == 0 {
+		return SaveResult{}, nil
+	}
+	if w.opts.Mode != SaveAtomic {
+		saved, err := saveRecommendations(ctx, recommendations, w.opts)
+		w.saved.Add(saved)
+		return saved, err
+	}
+
+	if w.tx == nil {
+		//The transaction spans the whole sync on a session outside the pool,
+		//which archiving and dead lettering keep using meanwhile
+		conn, err := connection.GetDedicatedConnection()
+		if err != nil {
+			return SaveResult{}, fmt.Errorf("failed to get database connection: %w", err)
+		}
+		tx, err := conn.BeginConn(ctx)
+		if err != nil {
+			conn.CloseConn(context.Background())
+			return SaveResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		w.conn, w.tx = conn, tx
+	}
+
+	saved, err := saveBatch(w.tx, ctx, recommendations)
+	if err != nil {
+		w.opts.batchFailed(recommendations, err)
+		w.pending.Failed += len(recommendations)
+		return SaveResult{Failed: len(recommendations)}, fmt.Errorf("failed to save recommendations, transaction rolled back: %w", err)
+	}
+	w.pending.Add(saved)
+	return saved, nil
+}
+
+// finish commits the SaveAtomic transaction when the sync ended without err,
+// rolls it back otherwise, and returns the totals of the run
+func (w *pageWriter) finish(ctx context.Context, err error) (SaveResult, error) {
+	if w.tx == nil {
+		return w.saved, nil
+	}
+	defer w.conn.CloseConn(context.Background())
+
+	//Rolled back rows count as failed
+	total := w.pending.Inserted + w.pending.Updated + w.pending.Unchanged + w.pending.Failed
+	if err != nil {
+		w.tx.Rollback(ctx)
+		return SaveResult{Failed: total}, nil
+	}
+	if err := w.tx.Commit(ctx); err != nil {
+		return SaveResult{Failed: total}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Printf("Saved recommendations: %s", w.pending)
+	return w.pending, nil
+}
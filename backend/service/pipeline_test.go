@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedSource serves pages of one item each, failing at page failAt and
+// adding an unknown field at page driftAt when they are set
+type pagedSource struct {
+	pages   int
+	failAt  int
+	driftAt int
+	fetched int
+}
+
+func (s *pagedSource) Name() string { return "paged" }
+
+func (s *pagedSource) FetchPage(ctx context.Context, token string) (*SourcePage, error) {
+	number := 1
+	if token != "" {
+		number, _ = strconv.Atoi(token)
+	}
+	s.fetched++
+	if number == s.failAt {
+		return nil, errors.New("unexpected status code 502")
+	}
+	page := &SourcePage{Items: []map[string]interface{}{{
+		"ticker":    fmt.Sprintf("T%d", number),
+		"company":   fmt.Sprintf("Company %d", number),
+		"action":    "upgraded by",
+		"brokerage": "Jefferies",
+		"time":      pagedTime(number).Format(time.RFC3339),
+	}}}
+	if number == s.driftAt {
+		page.Items[0]["price"] = 12.5
+	}
+	if number < s.pages {
+		page.NextPage = strconv.Itoa(number + 1)
+	}
+	return page, nil
+}
+
+// pagedTime is the time of the item of page number, newest first like the upstream API
+func pagedTime(number int) time.Time {
+	return time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC).Add(-time.Duration(number) * time.Hour)
+}
+
+func (s *pagedSource) Convert(item map[string]interface{}) (RecommendationData, error) {
+	rec, err := convertRecommendationData(item)
+	rec.Source = s.Name()
+	return rec, err
+}
+
+// fakeWriter is a recommendationWriter saving into a MemoryStore like
+// pageWriter: in SaveAtomic mode the batches are only stored when finish gets
+// no error. The batch number failAt, counting from 1, fails to save.
+type fakeWriter struct {
+	mode     SaveMode
+	failAt   int
+	store    *MemoryStore
+	batches  [][]RecommendationData
+	pending  []RecommendationData
+	saved    SaveResult
+	finished int
+}
+
+func newFakeWriter(mode SaveMode) *fakeWriter {
+	return &fakeWriter{mode: mode, store: NewMemoryStore()}
+}
+
+func (w *fakeWriter) save(ctx context.Context, recommendations []RecommendationData) (SaveResult, error) {
+	if len(recommendations) == 0 {
+		return SaveResult{}, nil
+	}
+	w.batches = append(w.batches, append([]RecommendationData(nil), recommendations...))
+	if len(w.batches) == w.failAt {
+		w.saved.Failed += len(recommendations)
+		return SaveResult{Failed: len(recommendations)}, errors.New("connection refused")
+	}
+	if w.mode == SaveAtomic {
+		w.pending = append(w.pending, recommendations...)
+		return SaveResult{Inserted: len(recommendations)}, nil
+	}
+	saved, err := w.store.UpsertRecommendations(ctx, recommendations, SaveOptions{})
+	w.saved.Add(saved)
+	return saved, err
+}
+
+func (w *fakeWriter) finish(ctx context.Context, err error) (SaveResult, error) {
+	w.finished++
+	if w.mode != SaveAtomic {
+		return w.saved, nil
+	}
+	if err != nil {
+		return SaveResult{Failed: len(w.pending) + w.saved.Failed}, nil
+	}
+	return w.store.UpsertRecommendations(ctx, w.pending, SaveOptions{})
+}
+
+// stored returns every recommendation the writer committed
+func (w *fakeWriter) stored(t *testing.T) []Recommendation {
+	recs, _, err := w.store.ListRecommendations(context.Background(), RecommendationFilter{Limit: 1000})
+	require.NoError(t, err)
+	return recs
+}
+
+// useFakeWriter makes the syncs and imports of the test save through a fakeWriter
+func useFakeWriter(t *testing.T, mode SaveMode) *fakeWriter {
+	writer := newFakeWriter(mode)
+	newWriter := newRecommendationWriter
+	t.Cleanup(func() { newRecommendationWriter = newWriter })
+	newRecommendationWriter = func(SaveOptions) recommendationWriter { return writer }
+	return writer
+}
+
+func TestFetchPages_DeliversPagesInOrder(t *testing.T) {
+	src := &pagedSource{pages: 5}
+
+	var tokens []string
+	for fetched := range fetchPages(context.Background(), src, "") {
+		require.NoError(t, fetched.err)
+		tokens = append(tokens, fetched.token)
+	}
+	assert.Equal(t, []string{"", "2", "3", "4", "5"}, tokens)
+}
+
+func TestFetchPages_StopsAtFirstError(t *testing.T) {
+	src := &pagedSource{pages: 5, failAt: 3}
+
+	var results []fetchedPage
+	for fetched := range fetchPages(context.Background(), src, "") {
+		results = append(results, fetched)
+	}
+	require.Len(t, results, 3)
+	assert.Error(t, results[2].err)
+	assert.Equal(t, 3, src.fetched)
+}
+
+func TestFetchPages_StopsWhenCancelled(t *testing.T) {
+	src := &pagedSource{pages: 1000}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pages := fetchPages(ctx, src, "")
+	<-pages
+	cancel()
+	for range pages {
+	}
+	assert.Less(t, src.fetched, 1000, "the fetcher stays at most a few pages ahead of the writer")
+}
+
+func TestConvertPage_CountsRejectedItems(t *testing.T) {
+	page := &SourcePage{Items: []map[string]interface{}{
+		{"ticker": "AAPL", "time": "2025-01-10T00:30:00Z"},
+		{"ticker": "MSFT"},
+	}}
+
+	var result SyncResult
+	recs := convertPage(&pagedSource{}, page, nil, &result)
+	require.Len(t, recs, 1)
+	assert.Equal(t, "paged", recs[0].Source)
+	assert.Equal(t, 1, result.Rejected)
+}
+
+func TestPageWriter_SkipsEmptyPages(t *testing.T) {
+	writer := newPageWriter(SaveOptions{Mode: SaveAtomic})
+
+	saved, err := writer.save(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{}, saved)
+
+	total, err := writer.finish(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{}, total)
+}
+
+func TestSyncAll_AtomicKeepsNothingWhenStopped(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   SaveMode
+		src    *pagedSource
+		status SyncStatus
+		stored int
+	}{
+		{name: "atomic, complete", mode: SaveAtomic, src: &pagedSource{pages: 3}, status: SyncComplete, stored: 3},
+		{name: "atomic, fetch error", mode: SaveAtomic, src: &pagedSource{pages: 3, failAt: 3}, status: SyncFailed, stored: 0},
+		{name: "atomic, schema drift", mode: SaveAtomic, src: &pagedSource{pages: 3, driftAt: 3}, status: SyncFailed, stored: 0},
+		{name: "batch, fetch error", mode: SaveBatch, src: &pagedSource{pages: 3, failAt: 3}, status: SyncPartial, stored: 2},
+		{name: "batch, schema drift", mode: SaveBatch, src: &pagedSource{pages: 3, driftAt: 3}, status: SyncPartial, stored: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := useFakeWriter(t, tt.mode)
+			archive := archiveFunc(func(int, string, *SourcePage) {})
+
+			result := syncAll(tt.src, SaveOptions{Mode: tt.mode}, nil, archive, newDriftCheck(DriftFail, tt.src.Name()))
+
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, 1, writer.finished)
+			assert.Len(t, writer.stored(t), tt.stored)
+			if tt.src.driftAt > 0 {
+				assert.ErrorIs(t, result.Err, ErrSchemaDrift)
+			}
+		})
+	}
+}
+
+func TestFetchOptions_Validate(t *testing.T) {
+	assert.NoError(t, FetchOptions{Incremental: true, Save: SaveOptions{Mode: SaveBatch}}.Validate())
+	assert.NoError(t, FetchOptions{Save: SaveOptions{Mode: SaveAtomic}}.Validate())
+
+	err := FetchOptions{Incremental: true, Save: SaveOptions{Mode: SaveAtomic}}.Validate()
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Equal(t, SyncFailed, runSync(&pagedSource{pages: 1}, FetchOptions{Incremental: true, Save: SaveOptions{Mode: SaveAtomic}}, IngestFetch).Status)
+}
+
+// useFakeSyncState keeps the checkpoints of the test in memory, starting from
+// state, and returns every checkpoint saved
+func useFakeSyncState(t *testing.T, state SyncState) *[]SyncState {
+	load, save := loadSyncState, saveSyncState
+	t.Cleanup(func() { loadSyncState, saveSyncState = load, save })
+
+	var checkpoints []SyncState
+	loadSyncState = func(ctx context.Context, name string) (*SyncState, error) {
+		loaded := state
+		loaded.Name = name
+		return &loaded, nil
+	}
+	saveSyncState = func(ctx context.Context, s *SyncState) error {
+		checkpoints = append(checkpoints, *s)
+		return nil
+	}
+	return &checkpoints
+}
+
+func TestSyncIncremental_Checkpoints(t *testing.T) {
+	stored := pagedTime(5)
+	newest := pagedTime(1)
+
+	tests := []struct {
+		name   string
+		state  SyncState
+		src    *pagedSource
+		status SyncStatus
+		saved  int
+		// tokens are the checkpointed next pages, last the final checkpoint
+		tokens []string
+		last   SyncState
+	}{
+		{
+			name:   "first run advances the watermark once complete",
+			src:    &pagedSource{pages: 3},
+			status: SyncComplete,
+			saved:  3,
+			tokens: []string{"2", "3", ""},
+			last:   SyncState{LastTime: &newest},
+		},
+		{
+			name:   "failed run keeps the watermark and checkpoints the failed page",
+			state:  SyncState{LastTime: &stored},
+			src:    &pagedSource{pages: 3, failAt: 3},
+			status: SyncPartial,
+			saved:  2,
+			tokens: []string{"2", "3"},
+			last:   SyncState{NextPage: "3", LastTime: &stored, RunMaxTime: &newest},
+		},
+		{
+			name:   "resumed run starts at the checkpoint and promotes the newest time of the run",
+			state:  SyncState{NextPage: "3", LastTime: &stored, RunMaxTime: &newest},
+			src:    &pagedSource{pages: 3},
+			status: SyncComplete,
+			saved:  1,
+			tokens: []string{""},
+			last:   SyncState{LastTime: &newest},
+		},
+		{
+			name:   "run stops at the items stored by the previous run",
+			state:  SyncState{LastTime: &stored},
+			src:    &pagedSource{pages: 8},
+			status: SyncComplete,
+			saved:  4,
+			tokens: []string{"2", "3", "4", "5", ""},
+			last:   SyncState{LastTime: &newest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := useFakeWriter(t, SaveBatch)
+			checkpoints := useFakeSyncState(t, tt.state)
+			archive := archiveFunc(func(int, string, *SourcePage) {})
+
+			result := syncIncremental(tt.src, SaveOptions{}, nil, archive, newDriftCheck(DriftWarn, tt.src.Name()))
+
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.saved, result.Saved.Inserted)
+			assert.Len(t, writer.stored(t), tt.saved)
+			tokens := make([]string, len(*checkpoints))
+			for i, c := range *checkpoints {
+				tokens[i] = c.NextPage
+			}
+			assert.Equal(t, tt.tokens, tokens)
+
+			last := (*checkpoints)[len(*checkpoints)-1]
+			tt.last.Name = "paged_recommendations"
+			assert.Equal(t, tt.last, last)
+		})
+	}
+}
+
+func TestSyncState_Complete(t *testing.T) {
+	older, newer := pagedTime(2), pagedTime(1)
+
+	tests := []struct {
+		name     string
+		state    SyncState
+		observed []time.Time
+		expected *time.Time
+	}{
+		{name: "first run", observed: []time.Time{older, newer}, expected: &newer},
+		{name: "newer items", state: SyncState{LastTime: &older}, observed: []time.Time{newer}, expected: &newer},
+		{name: "only older items", state: SyncState{LastTime: &newer}, observed: []time.Time{older}, expected: &newer},
+		{name: "nothing new", state: SyncState{LastTime: &older}, expected: &older},
+		{name: "empty first run"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.state
+			state.NextPage = "7"
+			for _, observed := range tt.observed {
+				state.Observe(observed)
+			}
+			assert.Equal(t, tt.state.LastTime, state.LastTime, "the watermark only moves once the run is complete")
+
+			state.Complete()
+			assert.Equal(t, tt.expected, state.LastTime)
+			assert.Nil(t, state.RunMaxTime)
+			assert.False(t, state.InProgress())
+		})
+	}
+}
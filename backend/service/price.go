@@ -0,0 +1,246 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultCurrency is assumed for prices written without a symbol or code
+const DefaultCurrency = "USD"
+
+// maxTargetPrice is the largest price the DECIMAL(10,2) target columns hold
+const maxTargetPrice = 99999999.99
+
+// Price is a parsed target price
+type Price struct {
+	Amount   float64
+	Currency string
+}
+
+// currencySymbols maps the symbols seen in upstream feeds to ISO 4217 codes.
+// Longer symbols come first so "US$" is not read as "$".
+var currencySymbols = []struct {
+	symbol   string
+	currency string
+}{
+	{"US$", "USD"}, {"C$", "CAD"}, {"CA$", "CAD"}, {"A$", "AUD"}, {"HK$", "HKD"},
+	{"$", "USD"}, {"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"}, {"₹", "INR"}, {"₩", "KRW"},
+}
+
+// ParsePrice parses a target price such as "$1,234.50", "€45", "45.00 USD",
+// "1.234,50 EUR", "-$12" or "($12.00)". Empty strings return nil without an
+// error; zero is a valid price. Prices with no currency are in DefaultCurrency.
+func ParsePrice(s string) (*Price, error) {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return nil, nil
+	}
+
+	negative := false
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		negative = true
+		text = strings.TrimSpace(text[1 : len(text)-1])
+	}
+	if strings.HasPrefix(text, "-") {
+		negative = !negative
+		text = strings.TrimSpace(text[1:])
+	}
+
+	text, currency := cutCurrency(text)
+	if strings.HasPrefix(text, "-") {
+		negative = !negative
+		text = strings.TrimSpace(text[1:])
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	amount, err := parseAmount(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price %q: %w", s, err)
+	}
+	if negative {
+		amount = -amount
+	}
+	return &Price{Amount: amount, Currency: currency}, nil
+}
+
+// cutCurrency removes a leading or trailing currency symbol or code from text
+func cutCurrency(text string) (string, string) {
+	//Symbols are matched on text itself, upper casing may change its length in bytes
+	for _, c := range currencySymbols {
+		if len(text) >= len(c.symbol) && strings.EqualFold(text[:len(c.symbol)], c.symbol) {
+			return strings.TrimSpace(text[len(c.symbol):]), c.currency
+		}
+		if len(text) >= len(c.symbol) && strings.EqualFold(text[len(text)-len(c.symbol):], c.symbol) {
+			return strings.TrimSpace(text[:len(text)-len(c.symbol)]), c.currency
+		}
+	}
+
+	//Three letter ISO codes, "USD 45" or "45 USD"
+	if fields := strings.Fields(text); len(fields) == 2 {
+		if isCurrencyCode(fields[0]) {
+			return fields[1], strings.ToUpper(fields[0])
+		}
+		if isCurrencyCode(fields[1]) {
+			return fields[0], strings.ToUpper(fields[1])
+		}
+	}
+	return text, ""
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAmount parses a number with optional thousands separators. When both
+// "," and "." appear the last one is the decimal separator; a lone "," is a
+// thousands separator only when followed by groups of three digits.
+func parseAmount(text string) (float64, error) {
+	if text == "" {
+		return 0, fmt.Errorf("no amount")
+	}
+	for _, r := range text {
+		if !unicode.IsDigit(r) && r != ',' && r != '.' && r != ' ' && r != '\'' {
+			return 0, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	text = strings.NewReplacer(" ", "", "'", "").Replace(text)
+
+	lastComma, lastDot := strings.LastIndex(text, ","), strings.LastIndex(text, ".")
+	decimal := ""
+	switch {
+	case lastComma >= 0 && lastDot >= 0:
+		decimal = "."
+		if lastComma > lastDot {
+			decimal = ","
+		}
+	case lastComma >= 0:
+		if strings.Count(text, ",") == 1 && !thousandsGrouped(text, ",") {
+			decimal = ","
+		}
+	case lastDot >= 0:
+		if strings.Count(text, ".") == 1 {
+			decimal = "."
+		}
+	}
+
+	integer, fraction := text, ""
+	if decimal != "" {
+		i := strings.LastIndex(text, decimal)
+		integer, fraction = text[:i], text[i+1:]
+	}
+	thousands := ","
+	if decimal == "," || (decimal == "" && lastDot >= 0) {
+		thousands = "."
+	}
+	if strings.Contains(integer, thousands) {
+		if !thousandsGrouped(integer, thousands) {
+			return 0, fmt.Errorf("misplaced thousands separator")
+		}
+		integer = strings.ReplaceAll(integer, thousands, "")
+	}
+	if strings.ContainsAny(integer, ",.") || strings.ContainsAny(fraction, ",.") {
+		return 0, fmt.Errorf("misplaced separators")
+	}
+	if integer == "" && fraction == "" {
+		return 0, fmt.Errorf("no amount")
+	}
+	return strconv.ParseFloat(integer+"."+fraction, 64)
+}
+
+// thousandsGrouped reports whether every group after the first separator has three digits
+func thousandsGrouped(text, separator string) bool {
+	groups := strings.Split(text, separator)
+	if len(groups[0]) == 0 || len(groups[0]) > 3 {
+		return false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatPrice writes a price so that ParsePrice reads it back: "$12.50" for
+// dollars and "12.50 EUR" for any other currency
+func FormatPrice(amount float64, currency string) string {
+	if currency == "" || currency == DefaultCurrency {
+		return fmt.Sprintf("$%.2f", amount)
+	}
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// IngestError is a field of a recommendation that could not be parsed. The
+// recommendation is still saved, with the field left empty.
+type IngestError struct {
+	Source      string `json:"source"`
+	Fingerprint string `json:"fingerprint"`
+	Ticker      string `json:"ticker"`
+	Field       string `json:"field"`
+	RawValue    string `json:"raw_value"`
+	Error       string `json:"error"`
+}
+
+// Targets is the parsed form of a recommendation's target prices
+type Targets struct {
+	From     *float64
+	To       *float64
+	Currency string
+}
+
+// ParseTargets parses both target prices and returns the errors of the ones
+// that cannot be stored. Negative prices and targets quoted in two different
+// currencies are rejected.
+func (d RecommendationData) ParseTargets() (Targets, []IngestError) {
+	var targets Targets
+	var errs []IngestError
+	reject := func(field, raw string, err error) {
+		errs = append(errs, IngestError{
+			Source:      d.sourceName(),
+			Fingerprint: d.Fingerprint(),
+			Ticker:      d.Ticker,
+			Field:       field,
+			RawValue:    raw,
+			Error:       err.Error(),
+		})
+	}
+
+	for _, t := range []struct {
+		field string
+		raw   string
+		dest  **float64
+	}{
+		{"target_from", d.TargetFrom, &targets.From},
+		{"target_to", d.TargetTo, &targets.To},
+	} {
+		price, err := ParsePrice(t.raw)
+		switch {
+		case err != nil:
+			reject(t.field, t.raw, err)
+		case price == nil:
+		case price.Amount < 0:
+			reject(t.field, t.raw, fmt.Errorf("negative target price"))
+		case price.Amount > maxTargetPrice:
+			reject(t.field, t.raw, fmt.Errorf("target price exceeds %.2f", maxTargetPrice))
+		case targets.Currency != "" && price.Currency != targets.Currency:
+			reject(t.field, t.raw, fmt.Errorf("currency %s differs from %s", price.Currency, targets.Currency))
+		default:
+			amount := price.Amount
+			*t.dest = &amount
+			targets.Currency = price.Currency
+		}
+	}
+	return targets, errs
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected *Price
+	}{
+		{input: "$1,234.50", expected: &Price{Amount: 1234.5, Currency: "USD"}},
+		{input: "$1,200,000", expected: &Price{Amount: 1200000, Currency: "USD"}},
+		{input: "$45", expected: &Price{Amount: 45, Currency: "USD"}},
+		{input: "$0.00", expected: &Price{Amount: 0, Currency: "USD"}},
+		{input: "€45", expected: &Price{Amount: 45, Currency: "EUR"}},
+		{input: "45.00 USD", expected: &Price{Amount: 45, Currency: "USD"}},
+		{input: "gbp 12.5", expected: &Price{Amount: 12.5, Currency: "GBP"}},
+		{input: "1.234,50 EUR", expected: &Price{Amount: 1234.5, Currency: "EUR"}},
+		{input: "45,5 €", expected: &Price{Amount: 45.5, Currency: "EUR"}},
+		{input: "C$80.25", expected: &Price{Amount: 80.25, Currency: "CAD"}},
+		{input: "-$12.00", expected: &Price{Amount: -12, Currency: "USD"}},
+		{input: "$-12.00", expected: &Price{Amount: -12, Currency: "USD"}},
+		{input: "($12.00)", expected: &Price{Amount: -12, Currency: "USD"}},
+		{input: "  ", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			price, err := ParsePrice(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, price)
+		})
+	}
+}
+
+func TestParsePrice_Errors(t *testing.T) {
+	for _, input := range []string{"$", "N/A", "$12.3.4", "$1,23.50", "12 dollars", "$1.2e5", "uſ$45", "45 hkſ"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParsePrice(input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFormatPrice_RoundTrips(t *testing.T) {
+	for _, currency := range []string{"", "USD", "EUR"} {
+		price, err := ParsePrice(FormatPrice(1234.5, currency))
+		require.NoError(t, err)
+		assert.Equal(t, 1234.5, price.Amount)
+	}
+	assert.Equal(t, "$1234.50", FormatPrice(1234.5, "USD"))
+	assert.Equal(t, "1234.50 EUR", FormatPrice(1234.5, "EUR"))
+}
+
+func TestRecommendationData_ParseTargets(t *testing.T) {
+	data := baseRecommendationData()
+	targets, errs := data.ParseTargets()
+	assert.Empty(t, errs)
+	assert.Equal(t, Targets{From: floatPtr(180), To: floatPtr(1200.5), Currency: "USD"}, targets)
+
+	data.TargetFrom = "N/A"
+	data.TargetTo = "€90"
+	targets, errs = data.ParseTargets()
+	assert.Equal(t, Targets{To: floatPtr(90), Currency: "EUR"}, targets)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "target_from", errs[0].Field)
+	assert.Equal(t, "N/A", errs[0].RawValue)
+	assert.Equal(t, data.Fingerprint(), errs[0].Fingerprint)
+
+	data.TargetFrom = "$100"
+	data.TargetTo = "(€90)"
+	_, errs = data.ParseTargets()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "negative target price", errs[0].Error)
+
+	data.TargetTo = "€90"
+	_, errs = data.ParseTargets()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error, "currency EUR differs from USD")
+}
+
+func TestMemoryStore_KeepsThousandsSeparatedTargets(t *testing.T) {
+	store := NewMemoryStore()
+	_, err := store.UpsertRecommendations(context.Background(), []RecommendationData{baseRecommendationData()}, SaveOptions{})
+	require.NoError(t, err)
+
+	recs, _, err := store.ListRecommendations(context.Background(), RecommendationFilter{})
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	require.NotNil(t, recs[0].TargetTo)
+	assert.Equal(t, 1200.5, *recs[0].TargetTo)
+	assert.Equal(t, "USD", recs[0].Currency)
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"stock-investment-backend/connection"
+	"strings"
+	"unicode"
+)
+
+// Canonical rating scale every brokerage rating is normalized to
+const (
+	RatingStrongSell = 1
+	RatingSell       = 2
+	RatingHold       = 3
+	RatingBuy        = 4
+	RatingStrongBuy  = 5
+)
+
+// RatingLabel names a score of the canonical scale
+func RatingLabel(score int) string {
+	switch score {
+	case RatingStrongSell:
+		return LabelStrongSell
+	case RatingSell:
+		return LabelSell
+	case RatingHold:
+		return LabelHold
+	case RatingBuy:
+		return LabelBuy
+	case RatingStrongBuy:
+		return LabelStrongBuy
+	}
+	return ""
+}
+
+// ValidRatingScore reports whether score is on the canonical scale
+func ValidRatingScore(score int) bool {
+	return score >= RatingStrongSell && score <= RatingStrongBuy
+}
+
+// RatingMapping maps a normalized raw rating to the canonical scale
+type RatingMapping struct {
+	RatingKey string `json:"rating_key"`
+	Score     int    `json:"score"`
+	Label     string `json:"label"`
+}
+
+// UnmappedRating is a raw rating with no mapping and how often it was seen
+type UnmappedRating struct {
+	Rating      string `json:"rating"`
+	Occurrences int    `json:"occurrences"`
+}
+
+// RatingKey normalizes a raw rating for lookup: lower case, with runs of
+// spaces, dashes and underscores collapsed to one space ("Strong-Buy" is
+// "strong buy"). It matches the rating_key() SQL function.
+func RatingKey(rating string) string {
+	fields := strings.FieldsFunc(strings.ToLower(rating), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-' || r == '_'
+	})
+	return strings.Join(fields, " ")
+}
+
+// defaultRatingScores is the built-in mapping, the same one seeded by the
+// rating normalization migration
+var defaultRatingScores = map[string]int{
+	"strong buy": 5, "top pick": 5, "conviction buy": 5,
+	"buy": 4, "outperform": 4, "overweight": 4, "market outperform": 4,
+	"sector outperform": 4, "outperformer": 4, "moderate buy": 4,
+	"speculative buy": 4, "accumulate": 4, "add": 4, "positive": 4,
+	"hold": 3, "neutral": 3, "market perform": 3, "sector perform": 3,
+	"peer perform": 3, "equal weight": 3, "sector weight": 3, "in line": 3,
+	"inline": 3, "perform": 3, "fair value": 3,
+	"sell": 2, "underperform": 2, "underweight": 2, "market underperform": 2,
+	"sector underperform": 2, "moderate sell": 2, "reduce": 2, "negative": 2,
+	"strong sell": 1,
+}
+
+// normalizeRating returns the canonical score of a raw rating, nil when it is empty or unmapped
+func normalizeRating(scores map[string]int, rating string) *int {
+	score, ok := scores[RatingKey(rating)]
+	if !ok {
+		return nil
+	}
+	return &score
+}
+
+func (s *PostgresStore) ListRatingMappings(ctx context.Context) ([]RatingMapping, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	rows, err := conn.Query(ctx, "SELECT rating_key, score FROM rating_mapping ORDER BY score DESC, rating_key ASC")
+	if err != nil {
+		return nil, dbError("query failed", err)
+	}
+	defer rows.Close()
+
+	var mappings []RatingMapping
+	for rows.Next() {
+		var m RatingMapping
+		if err := rows.Scan(&m.RatingKey, &m.Score); err != nil {
+			return nil, dbError("scan failed", err)
+		}
+		m.Label = RatingLabel(m.Score)
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+// ValidateRatingMapping checks a new mapping and returns the key of rating
+func ValidateRatingMapping(rating string, score int) (string, error) {
+	key := RatingKey(rating)
+	if key == "" {
+		return "", newError(ErrInvalidInput, "rating must not be empty")
+	}
+	if len(key) > 50 {
+		return "", newError(ErrInvalidInput, "rating must be at most 50 characters")
+	}
+	if !ValidRatingScore(score) {
+		return "", newError(ErrInvalidInput, "score %d is outside the rating scale %d-%d", score, RatingStrongSell, RatingStrongBuy)
+	}
+	return key, nil
+}
+
+func (s *PostgresStore) SetRatingMapping(ctx context.Context, rating string, score int) (int, error) {
+	key, err := ValidateRatingMapping(rating, score)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return 0, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	tx, err := conn.BeginConn(ctx)
+	if err != nil {
+		return 0, dbError("failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO rating_mapping (rating_key, score) VALUES ($1, $2)
+		ON CONFLICT (rating_key) DO UPDATE SET score = EXCLUDED.score, updated_at = now()`,
+		key, score)
+	if err != nil {
+		return 0, dbError("failed to save rating mapping", err)
+	}
+
+	updated, err := renormalizeRatings(tx, ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, dbError("failed to commit transaction", err)
+	}
+	return updated, nil
+}
+
+func (s *PostgresStore) ListUnmappedRatings(ctx context.Context) ([]UnmappedRating, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	rows, err := conn.Query(ctx, `
+		SELECT r.rating, COUNT(*)
+		FROM (
+			SELECT rating_from AS rating FROM analyst_recommendation
+			UNION ALL
+			SELECT rating_to FROM analyst_recommendation
+		) r
+		WHERE rating_key(r.rating) <> ''
+		AND NOT EXISTS (SELECT 1 FROM rating_mapping m WHERE m.rating_key = rating_key(r.rating))
+		GROUP BY r.rating
+		ORDER BY COUNT(*) DESC, r.rating ASC
+	`)
+	if err != nil {
+		return nil, dbError("query failed", err)
+	}
+	defer rows.Close()
+
+	var unmapped []UnmappedRating
+	for rows.Next() {
+		var u UnmappedRating
+		if err := rows.Scan(&u.Rating, &u.Occurrences); err != nil {
+			return nil, dbError("scan failed", err)
+		}
+		unmapped = append(unmapped, u)
+	}
+	return unmapped, rows.Err()
+}
+
+func (s *PostgresStore) RenormalizeRatings(ctx context.Context) (int, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return 0, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	return renormalizeRatings(conn, ctx, "")
+}
+
+// renormalizeRatings recomputes the rating scores of the recommendations
+// using the rating with the given key, or of all of them when key is empty
+func renormalizeRatings(q connection.Querier, ctx context.Context, key string) (int, error) {
+	tag, err := q.Exec(ctx, `
+		WITH normalized AS (
+			SELECT ar.id, rf.score AS from_score, rt.score AS to_score
+			FROM analyst_recommendation ar
+			LEFT JOIN rating_mapping rf ON rf.rating_key = rating_key(ar.rating_from)
+			LEFT JOIN rating_mapping rt ON rt.rating_key = rating_key(ar.rating_to)
+			WHERE $1 = '' OR $1 IN (rating_key(ar.rating_from), rating_key(ar.rating_to))
+		)
+		UPDATE analyst_recommendation ar
+		SET rating_from_score = n.from_score, rating_to_score = n.to_score, updated_at = now()
+		FROM normalized n
+		WHERE ar.id = n.id
+		AND (ar.rating_from_score, ar.rating_to_score) IS DISTINCT FROM (n.from_score, n.to_score)`,
+		key)
+	if err != nil {
+		return 0, dbError("failed to renormalize ratings", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
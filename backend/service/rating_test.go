@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "Strong-Buy", expected: "strong buy"},
+		{input: "  Market   Perform ", expected: "market perform"},
+		{input: "equal_weight", expected: "equal weight"},
+		{input: "In-Line", expected: "in line"},
+		{input: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RatingKey(tt.input))
+		})
+	}
+}
+
+func TestNormalizeRating(t *testing.T) {
+	tests := []struct {
+		rating   string
+		expected *int
+	}{
+		{rating: "Strong-Buy", expected: intPtr(RatingStrongBuy)},
+		{rating: "Outperform", expected: intPtr(RatingBuy)},
+		{rating: "Overweight", expected: intPtr(RatingBuy)},
+		{rating: "Market Perform", expected: intPtr(RatingHold)},
+		{rating: "Underweight", expected: intPtr(RatingSell)},
+		{rating: "Strong Sell", expected: intPtr(RatingStrongSell)},
+		{rating: "Speculative Hold", expected: nil},
+		{rating: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rating, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeRating(defaultRatingScores, tt.rating))
+		})
+	}
+}
+
+func TestValidateRatingMapping(t *testing.T) {
+	key, err := ValidateRatingMapping(" Speculative-Hold ", RatingHold)
+	require.NoError(t, err)
+	assert.Equal(t, "speculative hold", key)
+
+	_, err = ValidateRatingMapping("  ", RatingHold)
+	assert.Error(t, err)
+	_, err = ValidateRatingMapping("Hold", 6)
+	assert.Error(t, err)
+}
+
+func TestMemoryStore_RatingNormalization(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	data := baseRecommendationData()
+	data.RatingFrom = "Speculative Hold"
+	data.RatingTo = "Outperform"
+	other := baseRecommendationData()
+	other.Ticker = "MSFT"
+	other.RatingFrom = "speculative-hold"
+	_, err := store.UpsertRecommendations(ctx, []RecommendationData{data, other}, SaveOptions{})
+	require.NoError(t, err)
+
+	recs, _, err := store.ListRecommendations(ctx, RecommendationFilter{Ticker: "AAPL", Limit: 1})
+	require.NoError(t, err)
+	assert.Nil(t, recs[0].RatingFromScore)
+	assert.Equal(t, intPtr(RatingBuy), recs[0].RatingToScore)
+
+	unmapped, err := store.ListUnmappedRatings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []UnmappedRating{
+		{Rating: "Speculative Hold", Occurrences: 1},
+		{Rating: "speculative-hold", Occurrences: 1},
+	}, unmapped)
+
+	updated, err := store.SetRatingMapping(ctx, "Speculative Hold", RatingHold)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated, "both spellings share the key")
+
+	unmapped, err = store.ListUnmappedRatings(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, unmapped)
+
+	recs, _, err = store.ListRecommendations(ctx, RecommendationFilter{Ticker: "AAPL", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(RatingHold), recs[0].RatingFromScore)
+
+	//Nothing is left to change
+	updated, err = store.RenormalizeRatings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
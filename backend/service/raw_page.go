@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"stock-investment-backend/connection"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// encodePage gzips the JSON of a page's items for the raw_page archive
+func encodePage(items []map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(writer).Encode(items); err != nil {
+		return nil, fmt.Errorf("error encoding page: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing page: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodePage reads back the items written by encodePage
+func decodePage(payload []byte) ([]map[string]interface{}, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing page: %w", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing page: %w", err)
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("error decoding page: %w", err)
+	}
+	return items, nil
+}
+
+// archivePage stores the raw items of the number-th page fetched by the run,
+// read with token. Failures are logged, they never stop the sync.
+func (r *ingestRecorder) archivePage(number int, token string, page *SourcePage) {
+	if r == nil {
+		return
+	}
+	payload, err := encodePage(page.Items)
+	if err != nil {
+		log.Printf("⚠️  Page %d not archived: %v", number, err)
+		return
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		log.Printf("⚠️  Page %d not archived: %v", number, err)
+		return
+	}
+	defer conn.CloseConn(context.Background())
+
+	_, err = conn.Exec(context.Background(), `
+		INSERT INTO raw_page (run_id, page, token, next_page, url, item_count, payload)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		r.id, number, token, page.NextPage, page.URL, len(page.Items), payload)
+	if err != nil {
+		log.Printf("⚠️  Page %d not archived: %v", number, err)
+	}
+}
+
+// ReplaySource reads the pages archived by an earlier -fetch run instead of
+// the upstream API. Its tokens are page numbers.
+type ReplaySource struct {
+	runID string
+	name  string
+	// pages are the archived page numbers in order, pages that failed to be archived are missing
+	pages []int
+}
+
+// NewReplaySource opens the archive of the run with the given id
+func NewReplaySource(runID string) (*ReplaySource, error) {
+	if !isUUID(runID) {
+		return nil, newError(ErrInvalidInput, "invalid ingest run id %q", runID)
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	ctx := context.Background()
+	src := &ReplaySource{runID: runID}
+	err = conn.QueryRow(ctx, "SELECT source FROM ingest_run WHERE id = $1::uuid", runID).Scan(&src.name)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("ingest run %s: %w", runID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ingest run: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT page FROM raw_page WHERE run_id = $1::uuid ORDER BY page", runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load archived pages: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var page int
+		if err := rows.Scan(&page); err != nil {
+			return nil, fmt.Errorf("failed to load archived pages: %w", err)
+		}
+		src.pages = append(src.pages, page)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load archived pages: %w", err)
+	}
+
+	if len(src.pages) == 0 {
+		return nil, fmt.Errorf("ingest run %s has no archived pages", runID)
+	}
+	if last := src.pages[len(src.pages)-1]; last != len(src.pages) {
+		log.Printf("⚠️  %d of the %d pages of run %s were not archived, they are skipped", last-len(src.pages), last, runID)
+	}
+	return src, nil
+}
+
+// Name is the source of the replayed run, so replayed rows deduplicate against the original ones
+func (s *ReplaySource) Name() string {
+	return s.name
+}
+
+// pageAfter returns the token of the archived page following number, empty after the last one
+func (s *ReplaySource) pageAfter(number int) string {
+	i := sort.SearchInts(s.pages, number+1)
+	if i == len(s.pages) {
+		return ""
+	}
+	return strconv.Itoa(s.pages[i])
+}
+
+func (s *ReplaySource) FetchPage(ctx context.Context, token string) (*SourcePage, error) {
+	if len(s.pages) == 0 {
+		return nil, fmt.Errorf("ingest run %s has no archived pages", s.runID)
+	}
+	number := s.pages[0]
+	if token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid replay page %q", token)
+		}
+		number = n
+	}
+
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	var payload []byte
+	var url string
+	err = conn.QueryRow(ctx,
+		"SELECT payload, url FROM raw_page WHERE run_id = $1::uuid AND page = $2",
+		s.runID, number).Scan(&payload, &url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived page %d: %w", number, err)
+	}
+	items, err := decodePage(payload)
+	if err != nil {
+		return nil, fmt.Errorf("archived page %d: %w", number, err)
+	}
+
+	return &SourcePage{Items: items, URL: url, NextPage: s.pageAfter(number)}, nil
+}
+
+func (s *ReplaySource) Convert(item map[string]interface{}) (RecommendationData, error) {
+	rec, err := convertRecommendationData(item)
+	rec.Source = s.name
+	return rec, err
+}
+
+// Replay converts and saves the pages archived by the run with the given id
+// again, without calling the upstream API
+func Replay(runID string, saveOpts SaveOptions, drift DriftMode) SyncResult {
+	src, err := NewReplaySource(runID)
+	if err != nil {
+		var result SyncResult
+		result.finish(err)
+		return result
+	}
+	return runSync(src, FetchOptions{Save: saveOpts, Drift: drift}, IngestReplay)
+}
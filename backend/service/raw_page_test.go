@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodePage_RoundTrips(t *testing.T) {
+	items := []map[string]interface{}{
+		{"ticker": "AAPL", "target_to": "$1,200.50", "time": "2025-01-10T00:30:00Z"},
+		{"ticker": "MSFT", "rating_to": nil},
+	}
+
+	payload, err := encodePage(items)
+	require.NoError(t, err)
+	decoded, err := decodePage(payload)
+	require.NoError(t, err)
+	assert.Equal(t, items, decoded)
+}
+
+func TestDecodePage_RejectsCorruptPayload(t *testing.T) {
+	_, err := decodePage([]byte(`[{"ticker": "AAPL"}]`))
+	assert.Error(t, err, "payloads are gzipped")
+}
+
+func TestReplaySource_Convert(t *testing.T) {
+	src := &ReplaySource{runID: "run", name: "vendor", pages: []int{1}}
+
+	rec, err := src.Convert(map[string]interface{}{"ticker": "AAPL", "time": "2025-01-10T00:30:00Z"})
+	require.NoError(t, err)
+	assert.Equal(t, "vendor", rec.Source, "replayed rows keep the source of the original run")
+
+	_, err = src.FetchPage(context.Background(), "0")
+	assert.Error(t, err)
+}
+
+func TestReplaySource_PageAfter(t *testing.T) {
+	//Page 3 failed to be archived, the replay goes from 2 to 4
+	src := &ReplaySource{pages: []int{1, 2, 4}}
+
+	assert.Equal(t, "2", src.pageAfter(1))
+	assert.Equal(t, "4", src.pageAfter(2))
+	assert.Equal(t, "4", src.pageAfter(3))
+	assert.Equal(t, "", src.pageAfter(4))
+}
+
+func TestNewReplaySource_InvalidRunID(t *testing.T) {
+	_, err := NewReplaySource("42; DROP TABLE raw_page")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
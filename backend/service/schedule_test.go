@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	//Wednesday
+	from := time.Date(2025, 1, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		spec string
+		want time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2025, 1, 15, 10, 8, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", time.Date(2025, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"hourly", "@hourly", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"daily", "@daily", time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"weekly is sunday", "@weekly", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "30 6 * * 7", time.Date(2025, 1, 19, 6, 30, 0, 0, time.UTC)},
+		{"list and range", "0 9-17 * * 1,3", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"weekdays next day", "0 8 * * 1-5", time.Date(2025, 1, 16, 8, 0, 0, 0, time.UTC)},
+		{"day of month", "0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"day of month or weekday", "0 0 20 * 5", time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"month rollover", "0 0 1 3 *", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"interval", "@every 90m", time.Date(2025, 1, 15, 11, 37, 30, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Next(from))
+		})
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"0 0 31 2 *",
+		"@every soon",
+		"@every 10s",
+		"@yearly",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := ParseSchedule(spec)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"stock-investment-backend/connection"
+	"sync"
+	"time"
+)
+
+// SyncLock keeps two processes from syncing at the same time
+type SyncLock interface {
+	// TryLock returns ok=false without waiting when the lock is held elsewhere;
+	// unlock must be called once the sync is done
+	TryLock(ctx context.Context) (unlock func(), ok bool, err error)
+}
+
+// SyncLockKey identifies the sync among PostgreSQL advisory locks
+const SyncLockKey int64 = 0x73746f636b73796e // "stocksyn"
+
+// ErrSyncLocked is returned by syncs started while another one holds the sync lock
+var ErrSyncLocked = errors.New("another sync is running")
+
+// syncLock is taken by every fetch, replay and import, whichever process runs it
+var syncLock SyncLock = AdvisoryLock{Key: SyncLockKey}
+
+// lockSync takes syncLock without waiting, failing with ErrSyncLocked when it is held
+func lockSync() (unlock func(), err error) {
+	unlock, ok, err := syncLock.TryLock(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to take the sync lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrSyncLocked
+	}
+	return unlock, nil
+}
+
+// AdvisoryLock is a SyncLock held as a PostgreSQL session advisory lock, so
+// it is shared by every process using the database and released by the
+// server if the holder dies. Its session is dedicated, it does not take a
+// slot of the pool the sync itself uses.
+type AdvisoryLock struct {
+	Key int64
+}
+
+func (l AdvisoryLock) TryLock(ctx context.Context) (func(), bool, error) {
+	conn, err := connection.GetDedicatedConnection()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", l.Key).Scan(&locked); err != nil {
+		conn.CloseConn(context.Background())
+		return nil, false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !locked {
+		conn.CloseConn(context.Background())
+		return nil, false, nil
+	}
+
+	//The lock belongs to the session, release it on the same connection
+	return func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", l.Key); err != nil {
+			log.Printf("⚠️  Failed to release the sync lock: %v", err)
+		}
+		conn.CloseConn(context.Background())
+	}, true, nil
+}
+
+// ScheduledRun is the outcome of one activation of the scheduler
+type ScheduledRun struct {
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+	Status     SyncStatus `json:"status"`
+	Summary    string     `json:"summary"`
+}
+
+// SchedulerStatus is a snapshot of the scheduler
+type SchedulerStatus struct {
+	Schedule string        `json:"schedule"`
+	Running  bool          `json:"running"`
+	NextRun  *time.Time    `json:"next_run"`
+	LastRun  *ScheduledRun `json:"last_run"`
+}
+
+// Scheduler runs a sync job on a cron-like schedule. The job takes the sync
+// lock, activations that find it held by another sync are skipped.
+type Scheduler struct {
+	schedule Schedule
+	job      func() SyncResult
+	now      func() time.Time
+
+	mu     sync.Mutex
+	status SchedulerStatus
+}
+
+// NewScheduler parses spec (see ParseSchedule) and returns a scheduler running job
+func NewScheduler(spec string, job func() SyncResult) (*Scheduler, error) {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		schedule: schedule,
+		job:      job,
+		now:      time.Now,
+		status:   SchedulerStatus{Schedule: spec},
+	}, nil
+}
+
+// Status returns a copy of the current status
+func (s *Scheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status
+	if s.status.LastRun != nil {
+		last := *s.status.LastRun
+		status.LastRun = &last
+	}
+	return status
+}
+
+// Run triggers the job at every activation of the schedule until ctx is done.
+// A run in progress is finished before Run returns.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next := s.schedule.Next(s.now())
+		s.mu.Lock()
+		s.status.NextRun = &next
+		s.mu.Unlock()
+		fmt.Printf("🕒 Next sync at %s\n", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runOnce(ctx)
+	}
+}
+
+// runOnce runs the job and records the outcome
+func (s *Scheduler) runOnce(ctx context.Context) ScheduledRun {
+	run := ScheduledRun{StartedAt: s.now()}
+
+	s.setRunning(true)
+	result := s.job()
+	s.setRunning(false)
+	run.Status = result.Status
+	if result.Status == SyncSkipped {
+		run.Summary = ErrSyncLocked.Error()
+		fmt.Println("⏭️  Scheduled sync skipped, another sync is running")
+	} else {
+		run.Summary = result.String()
+		fmt.Printf("Scheduled sync %s\n", result)
+	}
+	run.FinishedAt = s.now()
+
+	s.mu.Lock()
+	s.status.LastRun = &run
+	s.mu.Unlock()
+	return run
+}
+
+func (s *Scheduler) setRunning(running bool) {
+	s.mu.Lock()
+	s.status.Running = running
+	s.mu.Unlock()
+}
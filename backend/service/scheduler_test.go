@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLock is a SyncLock held by someone else while held is set
+type fakeLock struct {
+	held     bool
+	err      error
+	unlocked int
+}
+
+func (l *fakeLock) TryLock(ctx context.Context) (func(), bool, error) {
+	if l.err != nil || l.held {
+		return nil, false, l.err
+	}
+	return func() { l.unlocked++ }, true, nil
+}
+
+func TestScheduler_RunOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		lock       *fakeLock
+		wantStatus SyncStatus
+		wantRuns   int
+	}{
+		{"lock free", &fakeLock{}, SyncComplete, 1},
+		{"lock held", &fakeLock{held: true}, SyncSkipped, 0},
+		{"lock error", &fakeLock{err: errors.New("connection refused")}, SyncFailed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(lock SyncLock) { syncLock = lock }(syncLock)
+			syncLock = tt.lock
+
+			//Like runSync, the job takes the lock itself
+			runs := 0
+			sched, err := NewScheduler("@hourly", func() SyncResult {
+				unlock, err := lockSync()
+				if err != nil {
+					return notStarted(err)
+				}
+				defer unlock()
+				runs++
+				return SyncResult{Status: SyncComplete}
+			})
+			require.NoError(t, err)
+
+			run := sched.runOnce(context.Background())
+
+			assert.Equal(t, tt.wantStatus, run.Status)
+			assert.Equal(t, tt.wantRuns, runs)
+			assert.Equal(t, tt.wantRuns, tt.lock.unlocked)
+			status := sched.Status()
+			require.NotNil(t, status.LastRun)
+			assert.Equal(t, run, *status.LastRun)
+			assert.False(t, status.Running)
+		})
+	}
+}
+
+func TestLockSync(t *testing.T) {
+	defer func(lock SyncLock) { syncLock = lock }(syncLock)
+
+	syncLock = &fakeLock{held: true}
+	_, err := lockSync()
+	assert.ErrorIs(t, err, ErrSyncLocked)
+	assert.Equal(t, SyncSkipped, notStarted(err).Status)
+
+	//Every writer of recommendations takes the lock before touching the database
+	result, err := ReprocessFailed(ReprocessOptions{})
+	assert.ErrorIs(t, err, ErrSyncLocked)
+	assert.Equal(t, SyncSkipped, result.Status)
+
+	syncLock = &fakeLock{err: errors.New("connection refused")}
+	_, err = lockSync()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrSyncLocked)
+	assert.Equal(t, SyncFailed, notStarted(err).Status)
+}
+
+func TestScheduler_RunStopsWithContext(t *testing.T) {
+	sched, err := NewScheduler("@every 1m", func() SyncResult { return SyncResult{} })
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	sched.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sched.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return sched.Status().NextRun != nil }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, now.Add(time.Minute), *sched.Status().NextRun)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	assert.Nil(t, sched.Status().LastRun)
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StockScore is the investment score of a company, the same six-factor model
+// the dashboard used to compute in the browser
+type StockScore struct {
+	Ticker         string       `json:"ticker"`
+	CompanyName    string       `json:"company_name"`
+	TotalScore     float64      `json:"total_score"`
+	Metrics        ScoreMetrics `json:"metrics"`
+	Details        ScoreDetails `json:"details"`
+	Recommendation string       `json:"recommendation"`
+	Profile        string       `json:"profile"`
+}
+
+// ScoreMetrics are the factor scores, each on a 0-100 scale
+type ScoreMetrics struct {
+	RecommendationCount float64 `json:"recommendation_count"`
+	UpgradeRatio        float64 `json:"upgrade_ratio"`
+	AverageTargetUpside float64 `json:"average_target_upside"`
+	AnalystConsensus    float64 `json:"analyst_consensus"`
+	RecencyScore        float64 `json:"recency_score"`
+	BrokerageQuality    float64 `json:"brokerage_quality"`
+}
+
+// ScoreDetails are the raw figures the metrics were derived from
+type ScoreDetails struct {
+	TotalRecommendations       int     `json:"total_recommendations"`
+	Upgrades                   int     `json:"upgrades"`
+	Downgrades                 int     `json:"downgrades"`
+	Reiterations               int     `json:"reiterations"`
+	AverageTargetPrice         float64 `json:"average_target_price"`
+	CurrentTargetPrice         float64 `json:"current_target_price"`
+	UniqueBrokerages           int     `json:"unique_brokerages"`
+	DaysFromLastRecommendation int     `json:"days_from_last_recommendation"`
+}
+
+// Score labels, from best to worst
+const (
+	LabelStrongBuy  = "Strong Buy"
+	LabelBuy        = "Buy"
+	LabelHold       = "Hold"
+	LabelSell       = "Sell"
+	LabelStrongSell = "Strong Sell"
+)
+
+// ComputeScores scores every company in the store with profile, best first
+func ComputeScores(ctx context.Context, store RecommendationStore, profile ScoringProfile, now time.Time) ([]StockScore, error) {
+	var recommendations []Recommendation
+	err := store.StreamRecommendations(ctx, RecommendationFilter{}, func(r Recommendation) error {
+		recommendations = append(recommendations, r)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recommendations: %w", err)
+	}
+	return ScoreStocks(recommendations, profile, now), nil
+}
+
+// ComputeScore scores a single company. Brokerage quality depends on the whole
+// dataset, so every recommendation is still read.
+func ComputeScore(ctx context.Context, store RecommendationStore, ticker string, profile ScoringProfile, now time.Time) (*StockScore, error) {
+	scores, err := ComputeScores(ctx, store, profile, now)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scores {
+		if scores[i].Ticker == ticker {
+			return &scores[i], nil
+		}
+	}
+	//Also reached when the company lacks the coverage the profile requires
+	return nil, fmt.Errorf("score for %s: %w", ticker, ErrNotFound)
+}
+
+// ScoreStocks groups recommendations by company and scores each one with
+// profile, best first. Companies below the profile's minimum coverage are left out.
+func ScoreStocks(recommendations []Recommendation, profile ScoringProfile, now time.Time) []StockScore {
+	groups := map[string][]Recommendation{}
+	var tickers []string
+	for _, r := range recommendations {
+		ticker := r.Company.Ticker
+		if _, ok := groups[ticker]; !ok {
+			tickers = append(tickers, ticker)
+		}
+		groups[ticker] = append(groups[ticker], r)
+	}
+	sort.Strings(tickers)
+
+	premium := premiumBrokerages(recommendations)
+
+	scores := make([]StockScore, 0, len(tickers))
+	for _, ticker := range tickers {
+		if len(groups[ticker]) < profile.MinRecommendations {
+			continue
+		}
+		scores = append(scores, scoreStock(ticker, groups[ticker], premium, profile, now))
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].TotalScore > scores[j].TotalScore
+	})
+	return scores
+}
+
+// eventType falls back to classifying the action of recommendations stored
+// before event types existed
+func eventType(r Recommendation) EventType {
+	if r.EventType != "" {
+		return r.EventType
+	}
+	return ClassifyAction(r.Action)
+}
+
+func isUpgrade(r Recommendation) bool {
+	t := eventType(r)
+	return t == EventUpgrade || t == EventTargetRaise
+}
+
+func isDowngrade(r Recommendation) bool {
+	t := eventType(r)
+	return t == EventDowngrade || t == EventTargetCut
+}
+
+func isReiteration(r Recommendation) bool {
+	return eventType(r) == EventReiteration
+}
+
+// premiumBrokerages ranks brokerages with at least 5 recommendations by volume,
+// upgrade ratio and coverage, and returns the top 30% (at least 3)
+func premiumBrokerages(recommendations []Recommendation) []string {
+	type brokerageStats struct {
+		name      string
+		total     int
+		upgrades  int
+		companies map[string]bool
+		quality   float64
+	}
+
+	stats := map[string]*brokerageStats{}
+	for _, r := range recommendations {
+		if r.Brokerage == nil || r.Brokerage.Name == "" {
+			continue
+		}
+		b, ok := stats[r.Brokerage.Name]
+		if !ok {
+			b = &brokerageStats{name: r.Brokerage.Name, companies: map[string]bool{}}
+			stats[r.Brokerage.Name] = b
+		}
+		b.total++
+		if isUpgrade(r) {
+			b.upgrades++
+		}
+		b.companies[r.Company.Ticker] = true
+	}
+
+	var ranked []*brokerageStats
+	for _, b := range stats {
+		if b.total < 5 {
+			continue
+		}
+		accuracy := float64(b.upgrades) / float64(b.total) * 100
+		b.quality = math.Min(float64(b.total)/20, 1)*40 +
+			accuracy*0.4 +
+			math.Min(float64(len(b.companies))/10, 1)*20
+		ranked = append(ranked, b)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].quality != ranked[j].quality {
+			return ranked[i].quality > ranked[j].quality
+		}
+		return ranked[i].name < ranked[j].name
+	})
+
+	count := len(ranked) * 3 / 10
+	if count < 3 {
+		count = 3
+	}
+	if count > len(ranked) {
+		count = len(ranked)
+	}
+
+	names := make([]string, 0, count)
+	for _, b := range ranked[:count] {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+func scoreStock(ticker string, recommendations []Recommendation, premium []string, profile ScoringProfile, now time.Time) StockScore {
+	companyName := recommendations[0].Company.Name
+	if companyName == "" {
+		companyName = ticker
+	}
+
+	var details ScoreDetails
+	details.TotalRecommendations = len(recommendations)
+
+	brokerages := map[string]bool{}
+	var latest time.Time
+	var targets []float64
+	for _, r := range recommendations {
+		if isUpgrade(r) {
+			details.Upgrades++
+		}
+		if isDowngrade(r) {
+			details.Downgrades++
+		}
+		if isReiteration(r) {
+			details.Reiterations++
+		}
+		if r.TargetTo != nil && *r.TargetTo > 0 {
+			targets = append(targets, *r.TargetTo)
+		}
+		if r.Brokerage != nil && r.Brokerage.Name != "" {
+			brokerages[r.Brokerage.Name] = true
+		}
+		if r.Time.After(latest) {
+			latest = r.Time
+		}
+	}
+	details.UniqueBrokerages = len(brokerages)
+
+	//Upside is measured between the lowest and the average target
+	upside := 0.0
+	if len(targets) > 0 {
+		sum, lowest, highest := 0.0, targets[0], targets[0]
+		for _, t := range targets {
+			sum += t
+			lowest = math.Min(lowest, t)
+			highest = math.Max(highest, t)
+		}
+		details.AverageTargetPrice = sum / float64(len(targets))
+		details.CurrentTargetPrice = highest
+		upside = (details.AverageTargetPrice - lowest) / lowest * 100
+	}
+
+	details.DaysFromLastRecommendation = 999
+	if !latest.IsZero() {
+		details.DaysFromLastRecommendation = int(math.Floor(now.Sub(latest).Hours() / 24))
+	}
+
+	total := float64(len(recommendations))
+	metrics := ScoreMetrics{
+		RecommendationCount: math.Min(total/20*100, 100),
+		UpgradeRatio:        float64(details.Upgrades) / total * 100,
+		AverageTargetUpside: math.Min(math.Max(upside, 0), 100),
+		AnalystConsensus:    consensusScore(details.Upgrades, details.Downgrades, details.Reiterations),
+		RecencyScore:        profile.recency(details.DaysFromLastRecommendation),
+		BrokerageQuality:    brokerageQualityScore(recommendations, premium),
+	}
+
+	score := profile.total(metrics)
+
+	return StockScore{
+		Ticker:         ticker,
+		CompanyName:    companyName,
+		TotalScore:     math.Round(score*100) / 100,
+		Metrics:        metrics,
+		Details:        details,
+		Recommendation: profile.label(score),
+		Profile:        profile.Name,
+	}
+}
+
+// consensusScore rewards agreement among analysts, with a bonus when they agree on upgrades
+func consensusScore(upgrades, downgrades, reiterations int) float64 {
+	total := upgrades + downgrades + reiterations
+	if total == 0 {
+		return 0
+	}
+
+	largest := upgrades
+	if downgrades > largest {
+		largest = downgrades
+	}
+	if reiterations > largest {
+		largest = reiterations
+	}
+
+	bonus := 0.0
+	if upgrades == largest {
+		bonus = 20
+	}
+	return math.Min(float64(largest)/float64(total)*80+bonus, 100)
+}
+
+// brokerageQualityScore is the share of recommendations from premium brokerages plus a diversity bonus
+func brokerageQualityScore(recommendations []Recommendation, premium []string) float64 {
+	named, fromPremium := 0, 0
+	for _, r := range recommendations {
+		if r.Brokerage == nil || r.Brokerage.Name == "" {
+			continue
+		}
+		named++
+		for _, p := range premium {
+			if strings.Contains(r.Brokerage.Name, p) {
+				fromPremium++
+				break
+			}
+		}
+	}
+	if named == 0 {
+		return 0
+	}
+
+	ratio := float64(fromPremium) / float64(named)
+	diversity := math.Min(float64(named)/5, 1) * 20
+	return math.Min(ratio*80+diversity, 100)
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// DefaultProfileName is the built-in profile matching the dashboard's original model
+const DefaultProfileName = "default"
+
+// ScoringProfile configures the scoring model
+type ScoringProfile struct {
+	Name string `json:"name"`
+	// Weights of each factor in the total score, normalized by their sum
+	Weights ScoreMetrics `json:"weights"`
+	// RecencyHalfLifeDays makes the recency factor decay exponentially, halving
+	// every so many days. Zero keeps the linear decay of 2 points per day.
+	RecencyHalfLifeDays float64 `json:"recency_half_life_days"`
+	// MinRecommendations leaves out companies with less analyst coverage
+	MinRecommendations int          `json:"min_recommendations"`
+	Labels             LabelCutoffs `json:"labels"`
+}
+
+// LabelCutoffs are the minimum total scores of each label, anything below Sell is Strong Sell
+type LabelCutoffs struct {
+	StrongBuy float64 `json:"strong_buy"`
+	Buy       float64 `json:"buy"`
+	Hold      float64 `json:"hold"`
+	Sell      float64 `json:"sell"`
+}
+
+// DefaultScoringProfile returns the weights and thresholds the dashboard always used
+func DefaultScoringProfile() ScoringProfile {
+	return ScoringProfile{
+		Name: DefaultProfileName,
+		Weights: ScoreMetrics{
+			RecommendationCount: 0.15,
+			UpgradeRatio:        0.25,
+			AverageTargetUpside: 0.20,
+			AnalystConsensus:    0.20,
+			RecencyScore:        0.10,
+			BrokerageQuality:    0.10,
+		},
+		MinRecommendations: 1,
+		Labels:             LabelCutoffs{StrongBuy: 80, Buy: 65, Hold: 40, Sell: 20},
+	}
+}
+
+// Validate rejects profiles that cannot produce meaningful scores
+func (p ScoringProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("scoring profile without a name")
+	}
+	w := p.Weights
+	weights := []float64{w.RecommendationCount, w.UpgradeRatio, w.AverageTargetUpside, w.AnalystConsensus, w.RecencyScore, w.BrokerageQuality}
+	for _, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("profile %s: weights must not be negative", p.Name)
+		}
+	}
+	if p.weightSum() == 0 {
+		return fmt.Errorf("profile %s: at least one weight must be positive", p.Name)
+	}
+	if p.RecencyHalfLifeDays < 0 {
+		return fmt.Errorf("profile %s: recency_half_life_days must not be negative", p.Name)
+	}
+	l := p.Labels
+	if !(l.StrongBuy >= l.Buy && l.Buy >= l.Hold && l.Hold >= l.Sell) {
+		return fmt.Errorf("profile %s: label cut-offs must decrease from strong_buy to sell", p.Name)
+	}
+	return nil
+}
+
+func (p ScoringProfile) weightSum() float64 {
+	w := p.Weights
+	return w.RecommendationCount + w.UpgradeRatio + w.AverageTargetUpside + w.AnalystConsensus + w.RecencyScore + w.BrokerageQuality
+}
+
+// total combines the metrics with the profile weights
+func (p ScoringProfile) total(m ScoreMetrics) float64 {
+	w := p.Weights
+	weighted := m.RecommendationCount*w.RecommendationCount +
+		m.UpgradeRatio*w.UpgradeRatio +
+		m.AverageTargetUpside*w.AverageTargetUpside +
+		m.AnalystConsensus*w.AnalystConsensus +
+		m.RecencyScore*w.RecencyScore +
+		m.BrokerageQuality*w.BrokerageQuality
+	return weighted / p.weightSum()
+}
+
+// recency scores how long ago the latest recommendation was
+func (p ScoringProfile) recency(days int) float64 {
+	if p.RecencyHalfLifeDays > 0 {
+		return 100 * math.Pow(0.5, float64(days)/p.RecencyHalfLifeDays)
+	}
+	return math.Max(100-float64(days)*2, 0)
+}
+
+func (p ScoringProfile) label(score float64) string {
+	switch {
+	case score >= p.Labels.StrongBuy:
+		return LabelStrongBuy
+	case score >= p.Labels.Buy:
+		return LabelBuy
+	case score >= p.Labels.Hold:
+		return LabelHold
+	case score >= p.Labels.Sell:
+		return LabelSell
+	default:
+		return LabelStrongSell
+	}
+}
+
+// ScoringProfiles are the selectable profiles by name
+type ScoringProfiles map[string]ScoringProfile
+
+// DefaultScoringProfiles holds only the built-in default profile
+func DefaultScoringProfiles() ScoringProfiles {
+	return ScoringProfiles{DefaultProfileName: DefaultScoringProfile()}
+}
+
+// Get returns the named profile, the default one when name is empty
+func (p ScoringProfiles) Get(name string) (ScoringProfile, error) {
+	if name == "" {
+		name = DefaultProfileName
+	}
+	profile, ok := p[name]
+	if !ok {
+		return ScoringProfile{}, newError(ErrInvalidInput, "unknown scoring profile %q (available: %v)", name, p.Names())
+	}
+	return profile, nil
+}
+
+// Names lists the profiles alphabetically
+func (p ScoringProfiles) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadScoringProfiles reads the profiles of a JSON file on top of the default
+// one. Weights left out of a profile are 0, its other fields keep the default
+// profile's values, and a profile named "default" replaces the built-in one.
+func LoadScoringProfiles(path string) (ScoringProfiles, error) {
+	profiles := DefaultScoringProfiles()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scoring profiles: %w", err)
+	}
+
+	var raw struct {
+		Profiles []json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing scoring profiles: %w", err)
+	}
+
+	for _, message := range raw.Profiles {
+		profile := DefaultScoringProfile()
+		profile.Name = ""
+		//A profile only scores the factors it lists
+		profile.Weights = ScoreMetrics{}
+		if err := json.Unmarshal(message, &profile); err != nil {
+			return nil, fmt.Errorf("error parsing scoring profile: %w", err)
+		}
+		if err := profile.Validate(); err != nil {
+			return nil, err
+		}
+		profiles[profile.Name] = profile
+	}
+	return profiles, nil
+}
+
+// LoadScoringProfilesFromEnv loads SCORING_PROFILES_FILE when it is set
+func LoadScoringProfilesFromEnv() (ScoringProfiles, error) {
+	path := os.Getenv("SCORING_PROFILES_FILE")
+	if path == "" {
+		return DefaultScoringProfiles(), nil
+	}
+	return LoadScoringProfiles(path)
+}
+
+// ProfileComparison is the position of a company under two scoring profiles.
+// A zero rank means the profile left the company out for lack of coverage.
+type ProfileComparison struct {
+	Ticker string
+	RankA  int
+	RankB  int
+	ScoreA float64
+	ScoreB float64
+	LabelA string
+	LabelB string
+}
+
+// RankChange is how many places the company moved from profile A to B, positive when it climbed
+func (c ProfileComparison) RankChange() int {
+	if c.RankA == 0 || c.RankB == 0 {
+		return 0
+	}
+	return c.RankA - c.RankB
+}
+
+// CompareRankings lines up two rankings by company, ordered by the first one
+func CompareRankings(a, b []StockScore) []ProfileComparison {
+	byTicker := map[string]*ProfileComparison{}
+	var comparisons []*ProfileComparison
+
+	for i, s := range a {
+		c := &ProfileComparison{Ticker: s.Ticker, RankA: i + 1, ScoreA: s.TotalScore, LabelA: s.Recommendation}
+		byTicker[s.Ticker] = c
+		comparisons = append(comparisons, c)
+	}
+	for i, s := range b {
+		c, ok := byTicker[s.Ticker]
+		if !ok {
+			c = &ProfileComparison{Ticker: s.Ticker}
+			comparisons = append(comparisons, c)
+		}
+		c.RankB, c.ScoreB, c.LabelB = i+1, s.TotalScore, s.Recommendation
+	}
+
+	result := make([]ProfileComparison, 0, len(comparisons))
+	for _, c := range comparisons {
+		result = append(result, *c)
+	}
+	return result
+}
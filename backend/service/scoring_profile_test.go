@@ -0,0 +1,112 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProfiles(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadScoringProfiles(t *testing.T) {
+	path := writeProfiles(t, `{"profiles": [
+		{"name": "momentum", "weights": {"upgrade_ratio": 0.6}, "recency_half_life_days": 7, "min_recommendations": 3}
+	]}`)
+
+	profiles, err := LoadScoringProfiles(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "momentum"}, profiles.Names())
+
+	momentum, err := profiles.Get("momentum")
+	require.NoError(t, err)
+	assert.Equal(t, 0.6, momentum.Weights.UpgradeRatio)
+	assert.Equal(t, 0.0, momentum.Weights.RecommendationCount, "unset weights are 0")
+	assert.Equal(t, 3, momentum.MinRecommendations)
+	assert.Equal(t, DefaultScoringProfile().Labels, momentum.Labels, "other unset fields keep the default values")
+
+	defaultProfile, err := profiles.Get("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultScoringProfile(), defaultProfile)
+
+	_, err = profiles.Get("missing")
+	assert.Error(t, err)
+}
+
+func TestLoadScoringProfiles_RejectsInvalidProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "no name", content: `{"profiles": [{"min_recommendations": 2}]}`},
+		{name: "negative weight", content: `{"profiles": [{"name": "x", "weights": {"upgrade_ratio": -1}}]}`},
+		{name: "zero weights", content: `{"profiles": [{"name": "x", "weights": {"recommendation_count": 0, "upgrade_ratio": 0, "average_target_upside": 0, "analyst_consensus": 0, "recency_score": 0, "brokerage_quality": 0}}]}`},
+		{name: "no weights", content: `{"profiles": [{"name": "x", "min_recommendations": 2}]}`},
+		{name: "unordered labels", content: `{"profiles": [{"name": "x", "weights": {"upgrade_ratio": 1}, "labels": {"strong_buy": 50, "buy": 60, "hold": 40, "sell": 20}}]}`},
+		{name: "malformed", content: `{"profiles": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadScoringProfiles(writeProfiles(t, tt.content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestScoringProfile_Recency(t *testing.T) {
+	linear := DefaultScoringProfile()
+	assert.Equal(t, 80.0, linear.recency(10))
+	assert.Equal(t, 0.0, linear.recency(60))
+
+	halfLife := DefaultScoringProfile()
+	halfLife.RecencyHalfLifeDays = 10
+	assert.InDelta(t, 50, halfLife.recency(10), 1e-9)
+	assert.InDelta(t, 25, halfLife.recency(20), 1e-9)
+}
+
+func TestScoreStocks_ProfileChangesRanking(t *testing.T) {
+	recs := []Recommendation{
+		//AAPL: well covered but stale
+		scoredRecommendation("AAPL", "Goldman Sachs", "reiterated by", 100, 30),
+		scoredRecommendation("AAPL", "Morgan Stanley", "reiterated by", 100, 30),
+		scoredRecommendation("AAPL", "Jefferies", "reiterated by", 100, 30),
+		//TSLA: a single fresh upgrade
+		scoredRecommendation("TSLA", "Wedbush", "upgraded by", 300, 0),
+	}
+
+	coverage := DefaultScoringProfile()
+	coverage.Name = "coverage"
+	coverage.Weights = ScoreMetrics{RecommendationCount: 1}
+
+	momentum := DefaultScoringProfile()
+	momentum.Name = "momentum"
+	momentum.Weights = ScoreMetrics{UpgradeRatio: 1, RecencyScore: 1}
+	momentum.MinRecommendations = 1
+
+	a := ScoreStocks(recs, coverage, scoringNow)
+	b := ScoreStocks(recs, momentum, scoringNow)
+	assert.Equal(t, "AAPL", a[0].Ticker)
+	assert.Equal(t, "TSLA", b[0].Ticker)
+	assert.Equal(t, "momentum", b[0].Profile)
+	assert.InDelta(t, 100, b[0].TotalScore, 1e-9, "weights are normalized by their sum")
+
+	strict := coverage
+	strict.MinRecommendations = 2
+	c := ScoreStocks(recs, strict, scoringNow)
+	require.Len(t, c, 1)
+
+	comparison := CompareRankings(c, b)
+	require.Len(t, comparison, 2)
+	assert.Equal(t, ProfileComparison{Ticker: "AAPL", RankA: 1, RankB: 2, ScoreA: a[0].TotalScore, ScoreB: b[1].TotalScore, LabelA: a[0].Recommendation, LabelB: b[1].Recommendation}, comparison[0])
+	assert.Equal(t, -1, comparison[0].RankChange())
+	assert.Equal(t, "TSLA", comparison[1].Ticker)
+	assert.Equal(t, 0, comparison[1].RankA, "left out of the strict profile")
+	assert.Equal(t, 0, comparison[1].RankChange())
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var scoringNow = time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+
+func scoredRecommendation(ticker, brokerage, action string, target float64, daysAgo int) Recommendation {
+	r := Recommendation{
+		Company: Company{Ticker: ticker, Name: ticker + " Inc."},
+		Action:  action,
+		Time:    scoringNow.Add(-time.Duration(daysAgo) * 24 * time.Hour),
+	}
+	if brokerage != "" {
+		r.Brokerage = &Brokerage{Name: brokerage}
+	}
+	if target > 0 {
+		r.TargetTo = &target
+	}
+	return r
+}
+
+func TestScoreStocks_Metrics(t *testing.T) {
+	recs := []Recommendation{
+		scoredRecommendation("AAPL", "Goldman Sachs", "upgraded by", 200, 1),
+		scoredRecommendation("AAPL", "Morgan Stanley", "target raised by", 250, 3),
+		scoredRecommendation("AAPL", "Jefferies", "reiterated by", 0, 5),
+		scoredRecommendation("AAPL", "", "target lowered by", 150, 10),
+	}
+
+	scores := ScoreStocks(recs, DefaultScoringProfile(), scoringNow)
+	require.Len(t, scores, 1)
+	s := scores[0]
+
+	assert.Equal(t, "AAPL Inc.", s.CompanyName)
+	assert.Equal(t, ScoreDetails{
+		TotalRecommendations:       4,
+		Upgrades:                   2,
+		Downgrades:                 1,
+		Reiterations:               1,
+		AverageTargetPrice:         200,
+		CurrentTargetPrice:         250,
+		UniqueBrokerages:           3,
+		DaysFromLastRecommendation: 1,
+	}, s.Details)
+
+	assert.InDelta(t, 20, s.Metrics.RecommendationCount, 1e-9)
+	assert.InDelta(t, 50, s.Metrics.UpgradeRatio, 1e-9)
+	assert.InDelta(t, 100.0/3, s.Metrics.AverageTargetUpside, 1e-9, "(avg 200 - min 150) / 150")
+	assert.InDelta(t, 60, s.Metrics.AnalystConsensus, 1e-9, "2 of 4 agree on upgrades: 0.5*80 + 20")
+	assert.InDelta(t, 98, s.Metrics.RecencyScore, 1e-9)
+	//No brokerage reaches 5 recommendations, so none is premium: only the diversity bonus
+	assert.InDelta(t, 12, s.Metrics.BrokerageQuality, 1e-9)
+
+	expected := 20*0.15 + 50*0.25 + (100.0/3)*0.2 + 60*0.2 + 98*0.1 + 12*0.1
+	assert.InDelta(t, expected, s.TotalScore, 0.005)
+	assert.Equal(t, LabelHold, s.Recommendation)
+}
+
+func TestScoreStocks_RanksBestFirstAndUsesPremiumBrokerages(t *testing.T) {
+	var recs []Recommendation
+	for i := 0; i < 20; i++ {
+		recs = append(recs, scoredRecommendation("NVDA", "Goldman Sachs", "upgraded by", 100+float64(i), 0))
+	}
+	recs = append(recs, scoredRecommendation("INTC", "Small Shop", "downgraded by", 30, 60))
+
+	scores := ScoreStocks(recs, DefaultScoringProfile(), scoringNow)
+	require.Len(t, scores, 2)
+	assert.Equal(t, "NVDA", scores[0].Ticker)
+	assert.Equal(t, "INTC", scores[1].Ticker)
+
+	assert.Equal(t, []string{"Goldman Sachs"}, premiumBrokerages(recs))
+	assert.InDelta(t, 100, scores[0].Metrics.BrokerageQuality, 1e-9)
+	assert.Equal(t, LabelStrongBuy, scores[0].Recommendation)
+	assert.Equal(t, LabelStrongSell, scores[1].Recommendation)
+	assert.Equal(t, 60, scores[1].Details.DaysFromLastRecommendation)
+}
+
+func TestScoreLabel(t *testing.T) {
+	tests := []struct {
+		score    float64
+		expected string
+	}{
+		{score: 80, expected: LabelStrongBuy},
+		{score: 79.99, expected: LabelBuy},
+		{score: 65, expected: LabelBuy},
+		{score: 40, expected: LabelHold},
+		{score: 20, expected: LabelSell},
+		{score: 19.99, expected: LabelStrongSell},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, DefaultScoringProfile().label(tt.score), tt.score)
+	}
+}
+
+func TestComputeScore_NotFound(t *testing.T) {
+	store := NewMemoryStore()
+	_, err := store.UpsertRecommendations(context.Background(), []RecommendationData{baseRecommendationData()}, SaveOptions{})
+	require.NoError(t, err)
+
+	score, err := ComputeScore(context.Background(), store, "AAPL", DefaultScoringProfile(), scoringNow)
+	require.NoError(t, err)
+	assert.Equal(t, "AAPL", score.Ticker)
+
+	_, err = ComputeScore(context.Background(), store, "MSFT", DefaultScoringProfile(), scoringNow)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"stock-investment-backend/connection"
+	"strings"
+	"unicode"
+)
+
+// SearchKind is the type of entity a search result points to
+type SearchKind string
+
+const (
+	SearchCompany   SearchKind = "company"
+	SearchBrokerage SearchKind = "brokerage"
+)
+
+// ParseSearchKind parses the type filter of a search, empty means every type
+func ParseSearchKind(s string) (SearchKind, error) {
+	switch kind := SearchKind(strings.ToLower(strings.TrimSpace(s))); kind {
+	case "", SearchCompany, SearchBrokerage:
+		return kind, nil
+	}
+	return "", newError(ErrInvalidInput, "invalid search type %q (expected company or brokerage)", s)
+}
+
+// SearchMatch is how a result matched the query, from the strongest to the weakest
+type SearchMatch string
+
+const (
+	// MatchTicker is a company whose ticker is the query
+	MatchTicker SearchMatch = "ticker"
+	// MatchPrefix is a ticker or name starting with the query
+	MatchPrefix SearchMatch = "prefix"
+	// MatchText is a name containing every word of the query
+	MatchText SearchMatch = "text"
+	// MatchFuzzy is a name or ticker similar to the query, e.g. with a typo
+	MatchFuzzy SearchMatch = "fuzzy"
+)
+
+// matchWeight ranks the kinds of match, the similarity breaks ties within one
+var matchWeight = map[SearchMatch]float64{MatchTicker: 3, MatchPrefix: 2, MatchText: 1, MatchFuzzy: 0}
+
+// fuzzyThreshold is the minimum trigram similarity of fuzzy matches, the default of pg_trgm
+const fuzzyThreshold = 0.3
+
+// SearchResult is a company or brokerage matching a search
+type SearchResult struct {
+	Type   SearchKind  `json:"type"`
+	ID     string      `json:"id"`
+	Ticker string      `json:"ticker,omitempty"`
+	Name   string      `json:"name"`
+	Match  SearchMatch `json:"match"`
+	// Score orders the results, best first: the weight of the match plus the trigram similarity
+	Score float64 `json:"score"`
+}
+
+// SearchQuery is a search over companies and brokerages
+type SearchQuery struct {
+	Text string
+	// Type limits the results to one kind of entity, every kind when empty
+	Type  SearchKind
+	Limit int
+}
+
+func (s *PostgresStore) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	conn, err := connection.GetDatabaseConnection()
+	if err != nil {
+		return nil, newError(ErrUnavailable, "database connection failed: %w", err)
+	}
+	defer conn.CloseConn(context.Background())
+
+	//$1 query, $2 prefix pattern, $3 type filter; every branch is served by the indexes of 0011_search
+	rows, err := conn.Query(ctx, `
+		WITH q AS (SELECT $1::text AS q, $2::text AS prefix, plainto_tsquery('simple', $1) AS ts)
+		SELECT type, id, ticker, name, match,
+			CASE match WHEN 'ticker' THEN 3 WHEN 'prefix' THEN 2 WHEN 'text' THEN 1 ELSE 0 END + similarity AS score
+		FROM (
+			SELECT 'company' AS type, c.id::text AS id, c.ticker, c.name,
+				CASE
+					WHEN upper(c.ticker) = upper(q.q) THEN 'ticker'
+					WHEN c.ticker ILIKE q.prefix OR c.name ILIKE q.prefix THEN 'prefix'
+					WHEN to_tsvector('simple', c.name) @@ q.ts THEN 'text'
+					ELSE 'fuzzy'
+				END AS match,
+				GREATEST(similarity(c.name, q.q), similarity(c.ticker, q.q)) AS similarity
+			FROM company c, q
+			WHERE $3 IN ('', 'company')
+				AND (c.ticker ILIKE q.prefix OR c.name ILIKE q.prefix
+					OR to_tsvector('simple', c.name) @@ q.ts
+					OR c.name % q.q OR c.ticker % q.q)
+			UNION ALL
+			SELECT 'brokerage', b.id::text, '', b.name,
+				CASE
+					WHEN b.name ILIKE q.prefix THEN 'prefix'
+					WHEN to_tsvector('simple', b.name) @@ q.ts THEN 'text'
+					ELSE 'fuzzy'
+				END,
+				similarity(b.name, q.q)
+			FROM brokerage b, q
+			WHERE $3 IN ('', 'brokerage')
+				AND (b.name ILIKE q.prefix OR to_tsvector('simple', b.name) @@ q.ts OR b.name % q.q)
+		) matches
+		ORDER BY score DESC, name, id
+		LIMIT $4`,
+		query.Text, escapeLike(query.Text)+"%", string(query.Type), query.Limit)
+	if err != nil {
+		return nil, dbError("search failed", err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.Type, &r.ID, &r.Ticker, &r.Name, &r.Match, &r.Score); err != nil {
+			return nil, dbError("scan failed", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// searchCandidate matches one entity against the query like the SQL of PostgresStore.Search
+func searchCandidate(kind SearchKind, id, ticker, name, q string) (SearchResult, bool) {
+	result := SearchResult{Type: kind, ID: id, Ticker: ticker, Name: name}
+	lowerQ := strings.ToLower(q)
+	similarity := trigramSimilarity(name, q)
+	if ticker != "" {
+		similarity = max(similarity, trigramSimilarity(ticker, q))
+	}
+
+	switch {
+	case ticker != "" && strings.EqualFold(ticker, q):
+		result.Match = MatchTicker
+	case (ticker != "" && strings.HasPrefix(strings.ToLower(ticker), lowerQ)) || strings.HasPrefix(strings.ToLower(name), lowerQ):
+		result.Match = MatchPrefix
+	case containsWords(name, q):
+		result.Match = MatchText
+	case similarity >= fuzzyThreshold:
+		result.Match = MatchFuzzy
+	default:
+		return result, false
+	}
+	result.Score = matchWeight[result.Match] + similarity
+	return result, true
+}
+
+// sortSearchResults orders results like PostgresStore.Search and keeps the first limit
+func sortSearchResults(results []SearchResult, limit int) []SearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// searchWords splits s into lower case words like the 'simple' text search configuration
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsWords reports whether every word of q is a word of name, like plainto_tsquery
+func containsWords(name, q string) bool {
+	queryWords := searchWords(q)
+	if len(queryWords) == 0 {
+		return false
+	}
+	nameWords := make(map[string]bool)
+	for _, w := range searchWords(name) {
+		nameWords[w] = true
+	}
+	for _, w := range queryWords {
+		if !nameWords[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// trigrams returns the trigram set of s the way pg_trgm builds it: each word
+// is padded with two spaces before and one after
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range searchWords(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// trigramSimilarity is pg_trgm's similarity(): shared trigrams over distinct trigrams
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
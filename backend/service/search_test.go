@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrigramSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, trigramSimilarity("Goldman Sachs", "goldman sachs"))
+	assert.Equal(t, 0.0, trigramSimilarity("Goldman Sachs", ""))
+	//goldman shares all its 8 trigrams, sacks 3 of its 6 with sachs
+	assert.InDelta(t, 11.0/17.0, trigramSimilarity("Goldman Sachs", "Goldman Sacks"), 1e-9)
+	assert.Less(t, trigramSimilarity("Goldman Sachs", "Morgan Stanley"), fuzzyThreshold)
+}
+
+func TestSearchCandidate(t *testing.T) {
+	tests := []struct {
+		query  string
+		ticker string
+		name   string
+		want   SearchMatch
+	}{
+		{"aapl", "AAPL", "Apple Inc.", MatchTicker},
+		{"aap", "AAPL", "Apple Inc.", MatchPrefix},
+		{"app", "AAPL", "Apple Inc.", MatchPrefix},
+		{"inc", "AAPL", "Apple Inc.", MatchText},
+		{"sachs goldman", "", "Goldman Sachs", MatchText},
+		{"Goldman Sacks", "", "Goldman Sachs", MatchFuzzy},
+		{"Morgan", "", "Goldman Sachs", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, ok := searchCandidate(SearchCompany, "1", tt.ticker, tt.name, tt.query)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, result.Match)
+		})
+	}
+}
+
+func TestMemoryStore_Search(t *testing.T) {
+	store := NewMemoryStore()
+	var data []RecommendationData
+	for _, r := range []struct{ ticker, company, brokerage string }{
+		{"GS", "Goldman Sachs Group", "Morgan Stanley"},
+		{"MS", "Morgan Stanley", "Goldman Sachs"},
+		{"AAPL", "Apple Inc.", "Goldman Sachs"},
+	} {
+		data = append(data, RecommendationData{
+			Ticker: r.ticker, Company: r.company, Brokerage: r.brokerage,
+			Action: "upgraded by", RatingTo: "Buy", Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	_, err := store.UpsertRecommendations(context.Background(), data, SaveOptions{})
+	require.NoError(t, err)
+
+	results, err := store.Search(context.Background(), SearchQuery{Text: "goldman", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	//Both names start with the query, the closer one ranks first
+	assert.Equal(t, SearchResult{Type: SearchBrokerage, ID: results[0].ID, Name: "Goldman Sachs", Match: MatchPrefix, Score: results[0].Score}, results[0])
+	assert.Equal(t, SearchCompany, results[1].Type)
+	assert.Equal(t, "GS", results[1].Ticker)
+	assert.Greater(t, results[0].Score, results[1].Score)
+
+	results, err = store.Search(context.Background(), SearchQuery{Text: "MS", Limit: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, MatchTicker, results[0].Match)
+	assert.Equal(t, "MS", results[0].Ticker)
+
+	results, err = store.Search(context.Background(), SearchQuery{Text: "goldman", Type: SearchCompany, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, SearchCompany, results[0].Type)
+
+	results, err = store.Search(context.Background(), SearchQuery{Text: "stanley", Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestParseSearchKind(t *testing.T) {
+	for _, s := range []string{"", "company", " Brokerage "} {
+		_, err := ParseSearchKind(s)
+		assert.NoError(t, err, s)
+	}
+	_, err := ParseSearchKind("ticker")
+	assert.Error(t, err)
+}
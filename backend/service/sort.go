@@ -0,0 +1,121 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// SortKey orders a listing by one field
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// RecommendationSortFields are the fields recommendation listings can be sorted by
+var RecommendationSortFields = []string{"time", "ticker", "brokerage", "target_to", "target_change", "rating"}
+
+// CompanySortFields are the fields company listings can be sorted by
+var CompanySortFields = []string{"ticker", "name", "created_at"}
+
+// recommendationSortColumns are the SQL expressions of RecommendationSortFields,
+// target_change orders like TargetChange
+var recommendationSortColumns = map[string]string{
+	"time":          "ar.time",
+	"ticker":        "c.ticker",
+	"brokerage":     "b.name",
+	"target_to":     "ar.target_to",
+	"target_change": "CASE WHEN ar.target_from > 0 THEN (ar.target_to - ar.target_from) / ar.target_from END",
+	"rating":        "ar.rating_to_score",
+}
+
+var companySortColumns = map[string]string{
+	"ticker":     "ticker",
+	"name":       "name",
+	"created_at": "created_at",
+}
+
+var (
+	defaultRecommendationSort = []SortKey{{Field: "time", Desc: true}}
+	defaultCompanySort        = []SortKey{{Field: "ticker"}}
+)
+
+// ParseSort parses a comma separated list of fields, each one descending when
+// prefixed with "-", e.g. "-time,ticker". Only the allowed fields are accepted.
+func ParseSort(spec string, allowed []string) ([]SortKey, error) {
+	var keys []SortKey
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		key.Field = strings.ToLower(strings.TrimPrefix(key.Field, "+"))
+		if !containsFold(allowed, key.Field, false) {
+			return nil, newError(ErrInvalidInput, "cannot sort by %q (allowed: %s)", key.Field, strings.Join(allowed, ", "))
+		}
+		if seen[key.Field] {
+			return nil, newError(ErrInvalidInput, "%q is sorted by more than once", key.Field)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// checkSort rejects the keys that columns cannot sort by
+func checkSort(keys []SortKey, columns map[string]string) error {
+	for _, key := range keys {
+		if _, ok := columns[key.Field]; !ok {
+			return newError(ErrInvalidInput, "cannot sort by %q", key.Field)
+		}
+	}
+	return nil
+}
+
+// orderBy builds the ORDER BY clause of keys, falling back to defaults. NULLs
+// sort last in both directions and tiebreak, in the direction of the first
+// key, keeps the order of pages stable.
+func orderBy(keys []SortKey, defaults []SortKey, columns map[string]string, tiebreak string) (string, error) {
+	if len(keys) == 0 {
+		keys = defaults
+	}
+	if err := checkSort(keys, columns); err != nil {
+		return "", err
+	}
+	terms := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		direction := "ASC"
+		if key.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s NULLS LAST", columns[key.Field], direction))
+	}
+	if keys[0].Desc {
+		tiebreak += " DESC"
+	}
+	terms = append(terms, tiebreak)
+	return " ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+// compareKey compares two values of a sort key
+func compareKey[T cmp.Ordered](a, b T, desc bool) int {
+	if desc {
+		return cmp.Compare(b, a)
+	}
+	return cmp.Compare(a, b)
+}
+
+// compareNullable is compareKey with nil values last, whatever the direction
+func compareNullable[T cmp.Ordered](a, b *T, desc bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return compareKey(*a, *b, desc)
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []SortKey
+	}{
+		{"", nil},
+		{"time", []SortKey{{Field: "time"}}},
+		{"-target_change, +ticker", []SortKey{{Field: "target_change", Desc: true}, {Field: "ticker"}}},
+		{"-Rating,", []SortKey{{Field: "rating", Desc: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			keys, err := ParseSort(tt.spec, RecommendationSortFields)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, keys)
+		})
+	}
+
+	for _, spec := range []string{"price", "time,-time", "name"} {
+		_, err := ParseSort(spec, RecommendationSortFields)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	order, err := orderBy(nil, defaultRecommendationSort, recommendationSortColumns, "ar.id")
+	require.NoError(t, err)
+	assert.Equal(t, " ORDER BY ar.time DESC NULLS LAST, ar.id DESC", order)
+
+	order, err = orderBy([]SortKey{{Field: "brokerage"}, {Field: "rating", Desc: true}}, defaultRecommendationSort, recommendationSortColumns, "ar.id")
+	require.NoError(t, err)
+	assert.Equal(t, " ORDER BY b.name ASC NULLS LAST, ar.rating_to_score DESC NULLS LAST, ar.id", order)
+
+	_, err = orderBy([]SortKey{{Field: "ar.id; DROP TABLE company"}}, defaultRecommendationSort, recommendationSortColumns, "ar.id")
+	assert.Error(t, err)
+}
+
+func TestMemoryStore_Sort(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	//Target changes: MSFT +50%, AAPL +10%, NVDA none
+	var batch []RecommendationData
+	for i, item := range []struct{ ticker, from, to string }{
+		{"MSFT", "$100", "$150"},
+		{"AAPL", "$100", "$110"},
+		{"NVDA", "", "$90"},
+	} {
+		data := baseRecommendationData()
+		data.Ticker = item.ticker
+		data.Company = item.ticker + " Inc."
+		data.TargetFrom = item.from
+		data.TargetTo = item.to
+		data.Time = start.Add(time.Duration(i) * time.Hour)
+		batch = append(batch, data)
+	}
+	_, err := store.UpsertRecommendations(ctx, batch, SaveOptions{})
+	require.NoError(t, err)
+
+	tickers := func(keys ...SortKey) []string {
+		recommendations, _, err := store.ListRecommendations(ctx, RecommendationFilter{Sort: keys, Limit: 10})
+		require.NoError(t, err)
+		var tickers []string
+		for _, r := range recommendations {
+			tickers = append(tickers, r.Company.Ticker)
+		}
+		return tickers
+	}
+
+	assert.Equal(t, []string{"NVDA", "AAPL", "MSFT"}, tickers(), "newest first by default")
+	assert.Equal(t, []string{"AAPL", "MSFT", "NVDA"}, tickers(SortKey{Field: "ticker"}))
+	assert.Equal(t, []string{"NVDA", "AAPL", "MSFT"}, tickers(SortKey{Field: "target_to"}))
+	assert.Equal(t, []string{"MSFT", "AAPL", "NVDA"}, tickers(SortKey{Field: "target_change", Desc: true}), "unknown changes last")
+	assert.Equal(t, []string{"AAPL", "MSFT", "NVDA"}, tickers(SortKey{Field: "target_change"}), "unknown changes last")
+	assert.Equal(t, []string{"MSFT", "AAPL", "NVDA"}, tickers(SortKey{Field: "brokerage"}, SortKey{Field: "time"}))
+
+	_, _, err = store.ListRecommendations(ctx, RecommendationFilter{Sort: []SortKey{{Field: "price"}}})
+	assert.Error(t, err)
+
+	companies, err := store.ListCompanies(ctx, []SortKey{{Field: "name", Desc: true}})
+	require.NoError(t, err)
+	require.Len(t, companies, 3)
+	assert.Equal(t, "NVDA", companies[0].Ticker)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultSourceName is the source recorded for the original upstream API
+const DefaultSourceName = "api"
+
+// SourcePage is one page of raw items returned by a Source
+type SourcePage struct {
+	Items []map[string]interface{}
+	// NextPage is the token of the following page, empty on the last page
+	NextPage string
+	// URL describes where the page was read from
+	URL string
+}
+
+// Source is a feed of analyst recommendations. Pages are addressed by opaque
+// tokens so a sync can checkpoint and resume; the empty token is the first page.
+type Source interface {
+	// Name is recorded in the source column of every stored recommendation
+	Name() string
+	FetchPage(ctx context.Context, token string) (*SourcePage, error)
+	// Convert maps a raw item to RecommendationData, rejecting invalid items
+	Convert(item map[string]interface{}) (RecommendationData, error)
+}
+
+// SourceFactory builds a configured source, typically from environment variables
+type SourceFactory func(retry RetryPolicy) (Source, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]SourceFactory{
+		DefaultSourceName: func(retry RetryPolicy) (Source, error) {
+			return NewAPISourceFromEnv(retry)
+		},
+	}
+)
+
+// RegisterSource makes a source selectable by name with -source
+func RegisterSource(name string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[name] = factory
+}
+
+// SourceNames lists the registered sources
+func SourceNames() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSource builds the registered source called name
+func NewSource(name string, retry RetryPolicy) (Source, error) {
+	sourcesMu.RLock()
+	factory, ok := sources[name]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(SourceNames(), ", "))
+	}
+	return factory(retry)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+type ApiResponse struct {
+	Items    []map[string]interface{} `json:"items"`
+	NextPage string                   `json:"next_page,omitempty"`
+}
+
+// APISource reads the paginated upstream API authenticated with a bearer token
+type APISource struct {
+	name    string
+	baseURL string
+	token   string
+	fetcher *Fetcher
+}
+
+func NewAPISource(name, baseURL, token string, fetcher *Fetcher) *APISource {
+	return &APISource{name: name, baseURL: baseURL, token: token, fetcher: fetcher}
+}
+
+// NewAPISourceFromEnv configures the default source from API_URL and BEARER_TOKEN
+func NewAPISourceFromEnv(retry RetryPolicy) (*APISource, error) {
+	err := godotenv.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		return nil, fmt.Errorf("API_URL is not set")
+	}
+	return NewAPISource(DefaultSourceName, apiURL, os.Getenv("BEARER_TOKEN"), NewFetcher(retry)), nil
+}
+
+func (s *APISource) Name() string {
+	return s.name
+}
+
+// FetchPage requests a single page of recommendations from the API
+func (s *APISource) FetchPage(ctx context.Context, token string) (*SourcePage, error) {
+	request_url := s.baseURL
+
+	if token != "" {
+		parsedUrl, err := url.Parse(s.baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing URL: %w", err)
+		}
+		query := parsedUrl.Query()
+		query.Set("next_page", token)
+		parsedUrl.RawQuery = query.Encode()
+		request_url = parsedUrl.String()
+	}
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer "+s.token)
+
+	body, err := s.fetcher.Get(ctx, request_url, header)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", request_url, err)
+	}
+
+	var apiResponse ApiResponse
+	err = json.Unmarshal(body, &apiResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling response body: %w", err)
+	}
+	return &SourcePage{Items: apiResponse.Items, NextPage: apiResponse.NextPage, URL: request_url}, nil
+}
+
+func (s *APISource) Convert(item map[string]interface{}) (RecommendationData, error) {
+	rec, err := convertRecommendationData(item)
+	rec.Source = s.name
+	return rec, err
+}
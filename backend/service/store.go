@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// Store is the persistence layer behind the API. PostgresStore is the production
+// implementation and MemoryStore a self-contained one for tests and local runs.
+type Store interface {
+	CompanyStore
+	BrokerageStore
+	RecommendationStore
+	RatingStore
+	IngestRunStore
+	SearchStore
+}
+
+type CompanyStore interface {
+	// ListCompanies returns every company ordered by CompanySortFields, by ticker when sort is empty
+	ListCompanies(ctx context.Context, sort []SortKey) ([]Company, error)
+	GetCompanyByTicker(ctx context.Context, ticker string) (*Company, error)
+}
+
+type BrokerageStore interface {
+	ListBrokerages(ctx context.Context) ([]Brokerage, error)
+	GetBrokerage(ctx context.Context, id string) (*Brokerage, error)
+}
+
+type RecommendationStore interface {
+	// ListRecommendations returns a page of recommendations matching filter and
+	// the total number of matches, -1 when filter.SkipCount is set
+	ListRecommendations(ctx context.Context, filter RecommendationFilter) ([]Recommendation, int, error)
+	// StreamRecommendations calls fn for every recommendation matching filter, ignoring
+	// Limit and Offset, and stops at the first error returned by fn
+	StreamRecommendations(ctx context.Context, filter RecommendationFilter, fn func(Recommendation) error) error
+	GetRecommendation(ctx context.Context, id string) (*Recommendation, error)
+	// UpsertRecommendations stores recommendations deduplicated by source and fingerprint
+	UpsertRecommendations(ctx context.Context, recommendations []RecommendationData, opts SaveOptions) (SaveResult, error)
+}
+
+// RatingStore manages the rating normalization table
+type RatingStore interface {
+	ListRatingMappings(ctx context.Context) ([]RatingMapping, error)
+	// SetRatingMapping creates or changes a mapping and renormalizes the
+	// recommendations using that rating, returning how many changed
+	SetRatingMapping(ctx context.Context, rating string, score int) (int, error)
+	// ListUnmappedRatings returns the stored raw ratings no mapping matches, most frequent first
+	ListUnmappedRatings(ctx context.Context) ([]UnmappedRating, error)
+	// RenormalizeRatings recomputes the scores of every stored recommendation, returning how many changed
+	RenormalizeRatings(ctx context.Context) (int, error)
+}
+
+// IngestRunStore reads the ingestion audit log
+type IngestRunStore interface {
+	// ListIngestRuns returns a page of runs, newest first, and the total number of runs
+	ListIngestRuns(ctx context.Context, limit, offset int) ([]IngestRun, int, error)
+	// ListSchemaReports returns a page of schema reports, newest first, and the total matching filter
+	ListSchemaReports(ctx context.Context, filter SchemaReportFilter, limit, offset int) ([]SchemaReport, int, error)
+}
+
+// SearchStore finds companies and brokerages by ticker or name
+type SearchStore interface {
+	// Search returns at most query.Limit matches, best first
+	Search(ctx context.Context, query SearchQuery) ([]SearchResult, error)
+}
+
+// RecommendationFilter selects recommendations, empty fields match everything
+type RecommendationFilter struct {
+	Ticker      string
+	BrokerageID string
+	Source      string
+	EventType   EventType
+	// Tickers, Actions and RatingsTo match any of their values, actions and
+	// ratings case-insensitively
+	Tickers   []string
+	Actions   []string
+	RatingsTo []string
+	// From and To bound the recommendation time, From inclusive and To exclusive
+	From *time.Time
+	To   *time.Time
+	// MinTarget and MaxTarget bound target_to, inclusive
+	MinTarget *float64
+	MaxTarget *float64
+	// MinTargetChange and MaxTargetChange bound the implied target change in
+	// percent, see TargetChange; recommendations without both targets never match
+	MinTargetChange *float64
+	MaxTargetChange *float64
+	// Company matches company names containing it, case-insensitively
+	Company string
+	// Sort orders the results by RecommendationSortFields, newest first when empty
+	Sort []SortKey
+	// Cursor pages from a position instead of Offset, see CursorSort for the sorts it supports
+	Cursor *Cursor
+	// SkipCount saves the count query, ListRecommendations then returns a total of -1
+	SkipCount bool
+	Limit     int
+	Offset    int
+}
+
+// TargetChange is the implied change of the price target in percent, nil
+// unless both targets are known and from is positive
+func TargetChange(from, to *float64) *float64 {
+	if from == nil || to == nil || *from <= 0 {
+		return nil
+	}
+	change := (*to - *from) / *from * 100
+	return &change
+}
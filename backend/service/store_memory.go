@@ -0,0 +1,630 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept entirely in memory. It follows the same
+// deduplication and ordering rules as PostgresStore, which makes it suitable
+// for tests and for running the API without a database.
+type MemoryStore struct {
+	mu              sync.RWMutex
+	companies       map[string]*Company // by ticker
+	brokerages      map[string]*Brokerage
+	brokerageByName map[string]string
+	recommendations []*memoryRecommendation
+	byFingerprint   map[string]*memoryRecommendation // by source and fingerprint
+	ratingScores    map[string]int                   // by rating key
+	now             func() time.Time
+}
+
+// memoryRecommendation references its company and brokerage so reads always see their current values
+type memoryRecommendation struct {
+	id          string
+	ticker      string
+	brokerageID string
+	targetFrom  *float64
+	targetTo    *float64
+	ratingFrom  string
+	ratingTo    string
+	fromScore   *int
+	toScore     *int
+	action      string
+	eventType   EventType
+	ratingDir   *int
+	targetDir   *int
+	currency    string
+	time        time.Time
+	source      string
+	fingerprint string
+	createdAt   time.Time
+	updatedAt   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		companies:       make(map[string]*Company),
+		brokerages:      make(map[string]*Brokerage),
+		brokerageByName: make(map[string]string),
+		byFingerprint:   make(map[string]*memoryRecommendation),
+		ratingScores:    make(map[string]int, len(defaultRatingScores)),
+		now:             time.Now,
+	}
+	for key, score := range defaultRatingScores {
+		s.ratingScores[key] = score
+	}
+	return s
+}
+
+// newID returns a random version 4 UUID
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate id: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (s *MemoryStore) ListCompanies(ctx context.Context, keys []SortKey) ([]Company, error) {
+	if len(keys) == 0 {
+		keys = defaultCompanySort
+	}
+	if err := checkSort(keys, companySortColumns); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	companies := make([]Company, 0, len(s.companies))
+	for _, c := range s.companies {
+		companies = append(companies, *c)
+	}
+	sort.Slice(companies, func(i, j int) bool {
+		a, b := companies[i], companies[j]
+		for _, key := range keys {
+			var c int
+			switch key.Field {
+			case "ticker":
+				c = compareKey(a.Ticker, b.Ticker, key.Desc)
+			case "name":
+				c = compareKey(a.Name, b.Name, key.Desc)
+			case "created_at":
+				c = compareKey(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano(), key.Desc)
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return a.ID < b.ID
+	})
+	return companies, nil
+}
+
+func (s *MemoryStore) GetCompanyByTicker(ctx context.Context, ticker string) (*Company, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.companies[ticker]
+	if !ok {
+		return nil, fmt.Errorf("company %s: %w", ticker, ErrNotFound)
+	}
+	company := *c
+	return &company, nil
+}
+
+func (s *MemoryStore) ListBrokerages(ctx context.Context) ([]Brokerage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	brokerages := make([]Brokerage, 0, len(s.brokerages))
+	for _, b := range s.brokerages {
+		brokerages = append(brokerages, *b)
+	}
+	sort.Slice(brokerages, func(i, j int) bool {
+		return brokerages[i].Name < brokerages[j].Name
+	})
+	return brokerages, nil
+}
+
+func (s *MemoryStore) GetBrokerage(ctx context.Context, id string) (*Brokerage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.brokerages[id]
+	if !ok {
+		return nil, fmt.Errorf("brokerage %s: %w", id, ErrNotFound)
+	}
+	brokerage := *b
+	return &brokerage, nil
+}
+
+func (s *MemoryStore) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := []SearchResult{}
+	if query.Type != SearchBrokerage {
+		for _, c := range s.companies {
+			if r, ok := searchCandidate(SearchCompany, c.ID, c.Ticker, c.Name, query.Text); ok {
+				results = append(results, r)
+			}
+		}
+	}
+	if query.Type != SearchCompany {
+		for _, b := range s.brokerages {
+			if r, ok := searchCandidate(SearchBrokerage, b.ID, "", b.Name, query.Text); ok {
+				results = append(results, r)
+			}
+		}
+	}
+	return sortSearchResults(results, query.Limit), nil
+}
+
+func (s *MemoryStore) ListRecommendations(ctx context.Context, filter RecommendationFilter) ([]Recommendation, int, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, 0, err
+	}
+	if err := checkSort(filter.Sort, recommendationSortColumns); err != nil {
+		return nil, 0, err
+	}
+	desc, err := checkCursor(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := s.matching(filter)
+
+	total := len(matches)
+	start := filter.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if filter.Limit > 0 && start+filter.Limit < end {
+		end = start + filter.Limit
+	}
+
+	if c := filter.Cursor; c != nil {
+		//Position of each match relative to the cursor, in listing order
+		position := func(i int) int {
+			p := compareKey(matches[i].time.UnixNano(), c.Time.UnixNano(), desc)
+			if p == 0 {
+				p = compareKey(matches[i].id, c.ID, desc)
+			}
+			return p
+		}
+		if c.Before {
+			end = sort.Search(total, func(i int) bool { return position(i) >= 0 })
+			start = 0
+			if filter.Limit > 0 && end-filter.Limit > 0 {
+				start = end - filter.Limit
+			}
+		} else {
+			start = sort.Search(total, func(i int) bool { return position(i) > 0 })
+			end = total
+			if filter.Limit > 0 && start+filter.Limit < end {
+				end = start + filter.Limit
+			}
+		}
+	}
+	if filter.SkipCount {
+		total = -1
+	}
+
+	recommendations := make([]Recommendation, 0, end-start)
+	for _, r := range matches[start:end] {
+		recommendations = append(recommendations, s.materialize(r))
+	}
+	return recommendations, total, nil
+}
+
+// StreamRecommendations calls fn on a snapshot of the matches, so fn may be slow without blocking writers
+func (s *MemoryStore) StreamRecommendations(ctx context.Context, filter RecommendationFilter, fn func(Recommendation) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	if err := checkSort(filter.Sort, recommendationSortColumns); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	matches := s.matching(filter)
+	recommendations := make([]Recommendation, 0, len(matches))
+	for _, r := range matches {
+		recommendations = append(recommendations, s.materialize(r))
+	}
+	s.mu.RUnlock()
+
+	for _, r := range recommendations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matching returns the recommendations selected by filter, newest first; callers hold the lock
+func (s *MemoryStore) matching(filter RecommendationFilter) []*memoryRecommendation {
+	var matches []*memoryRecommendation
+	for _, r := range s.recommendations {
+		if filter.Ticker != "" && r.ticker != filter.Ticker {
+			continue
+		}
+		if filter.BrokerageID != "" && r.brokerageID != filter.BrokerageID {
+			continue
+		}
+		if filter.Source != "" && r.source != filter.Source {
+			continue
+		}
+		if filter.EventType != "" && r.eventType != filter.EventType {
+			continue
+		}
+		if !s.matchesRange(r, filter) {
+			continue
+		}
+		matches = append(matches, r)
+	}
+
+	keys := filter.Sort
+	if len(keys) == 0 {
+		keys = defaultRecommendationSort
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if c := s.compareRecommendations(matches[i], matches[j], keys); c != 0 {
+			return c < 0
+		}
+		return compareKey(matches[i].id, matches[j].id, keys[0].Desc) < 0
+	})
+	return matches
+}
+
+// compareRecommendations orders a and b like the ORDER BY of PostgresStore; callers hold the lock
+func (s *MemoryStore) compareRecommendations(a, b *memoryRecommendation, keys []SortKey) int {
+	for _, key := range keys {
+		var c int
+		switch key.Field {
+		case "time":
+			c = compareKey(a.time.UnixNano(), b.time.UnixNano(), key.Desc)
+		case "ticker":
+			c = compareKey(a.ticker, b.ticker, key.Desc)
+		case "brokerage":
+			c = compareNullable(s.brokerageName(a), s.brokerageName(b), key.Desc)
+		case "target_to":
+			c = compareNullable(a.targetTo, b.targetTo, key.Desc)
+		case "target_change":
+			c = compareNullable(TargetChange(a.targetFrom, a.targetTo), TargetChange(b.targetFrom, b.targetTo), key.Desc)
+		case "rating":
+			c = compareNullable(a.toScore, b.toScore, key.Desc)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// brokerageName is nil for recommendations without a brokerage; callers hold the lock
+func (s *MemoryStore) brokerageName(r *memoryRecommendation) *string {
+	if b, ok := s.brokerages[r.brokerageID]; ok {
+		return &b.Name
+	}
+	return nil
+}
+
+// matchesRange applies the multi-value, time, target and company filters; callers hold the lock
+func (s *MemoryStore) matchesRange(r *memoryRecommendation, filter RecommendationFilter) bool {
+	if len(filter.Tickers) > 0 && !containsFold(filter.Tickers, r.ticker, false) {
+		return false
+	}
+	if len(filter.Actions) > 0 && !containsFold(filter.Actions, r.action, true) {
+		return false
+	}
+	if len(filter.RatingsTo) > 0 && !containsFold(filter.RatingsTo, r.ratingTo, true) {
+		return false
+	}
+	if filter.From != nil && r.time.Before(*filter.From) {
+		return false
+	}
+	if filter.To != nil && !r.time.Before(*filter.To) {
+		return false
+	}
+	if filter.MinTarget != nil && (r.targetTo == nil || *r.targetTo < *filter.MinTarget) {
+		return false
+	}
+	if filter.MaxTarget != nil && (r.targetTo == nil || *r.targetTo > *filter.MaxTarget) {
+		return false
+	}
+	if filter.MinTargetChange != nil || filter.MaxTargetChange != nil {
+		change := TargetChange(r.targetFrom, r.targetTo)
+		if change == nil {
+			return false
+		}
+		if filter.MinTargetChange != nil && *change < *filter.MinTargetChange {
+			return false
+		}
+		if filter.MaxTargetChange != nil && *change > *filter.MaxTargetChange {
+			return false
+		}
+	}
+	if filter.Company != "" {
+		c := s.companies[r.ticker]
+		if c == nil || !strings.Contains(strings.ToLower(c.Name), strings.ToLower(filter.Company)) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether values contains v, ignoring case when fold is set
+func containsFold(values []string, v string, fold bool) bool {
+	for _, candidate := range values {
+		if candidate == v || (fold && strings.EqualFold(candidate, v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) GetRecommendation(ctx context.Context, id string) (*Recommendation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.recommendations {
+		if r.id == id {
+			rec := s.materialize(r)
+			return &rec, nil
+		}
+	}
+	return nil, fmt.Errorf("recommendation %s: %w", id, ErrNotFound)
+}
+
+// UpsertRecommendations applies the same upsert rules as the Postgres merge.
+// Nothing can fail halfway in memory, so the save options do not change the outcome.
+func (s *MemoryStore) UpsertRecommendations(ctx context.Context, recommendations []RecommendationData, opts SaveOptions) (SaveResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result SaveResult
+	now := s.now()
+	seen := make(map[string]bool, len(recommendations))
+
+	for _, data := range recommendations {
+		fingerprint := data.Fingerprint()
+		key := data.sourceName() + "/" + fingerprint
+		if seen[key] {
+			result.Unchanged++
+			continue
+		}
+		seen[key] = true
+
+		ticker := normalizeTicker(data.Ticker)
+		if company, ok := s.companies[ticker]; !ok {
+			s.companies[ticker] = &Company{ID: newID(), Ticker: ticker, Name: data.Company, CreatedAt: now, UpdatedAt: now}
+		} else if data.Company != "" && company.Name != data.Company {
+			company.Name = data.Company
+			company.UpdatedAt = now
+		}
+
+		brokerageID := ""
+		if data.Brokerage != "" {
+			id, ok := s.brokerageByName[data.Brokerage]
+			if !ok {
+				id = newID()
+				s.brokerages[id] = &Brokerage{ID: id, Name: data.Brokerage, CreatedAt: now, UpdatedAt: now}
+				s.brokerageByName[data.Brokerage] = id
+			}
+			brokerageID = id
+		}
+
+		targets, _ := data.ParseTargets()
+		classification := data.Classify()
+		incoming := memoryRecommendation{
+			ticker:      ticker,
+			brokerageID: brokerageID,
+			targetFrom:  targets.From,
+			targetTo:    targets.To,
+			currency:    targets.Currency,
+			ratingFrom:  data.RatingFrom,
+			ratingTo:    data.RatingTo,
+			fromScore:   normalizeRating(s.ratingScores, data.RatingFrom),
+			toScore:     normalizeRating(s.ratingScores, data.RatingTo),
+			action:      data.Action,
+			eventType:   classification.EventType,
+			ratingDir:   classification.RatingDirection,
+			targetDir:   classification.TargetDirection,
+			time:        data.Time,
+			source:      data.sourceName(),
+			fingerprint: fingerprint,
+		}
+
+		existing, ok := s.byFingerprint[key]
+		if !ok {
+			incoming.id = newID()
+			incoming.createdAt = now
+			incoming.updatedAt = now
+			s.recommendations = append(s.recommendations, &incoming)
+			s.byFingerprint[key] = &incoming
+			result.Inserted++
+			continue
+		}
+
+		if existing.sameValues(&incoming) {
+			result.Unchanged++
+			continue
+		}
+		incoming.id = existing.id
+		incoming.createdAt = existing.createdAt
+		incoming.updatedAt = now
+		*existing = incoming
+		result.Updated++
+	}
+
+	return result, nil
+}
+
+func (r *memoryRecommendation) sameValues(other *memoryRecommendation) bool {
+	return r.ticker == other.ticker &&
+		r.brokerageID == other.brokerageID &&
+		equalTarget(r.targetFrom, other.targetFrom) &&
+		equalTarget(r.targetTo, other.targetTo) &&
+		r.ratingFrom == other.ratingFrom &&
+		r.ratingTo == other.ratingTo &&
+		equalScore(r.fromScore, other.fromScore) &&
+		equalScore(r.toScore, other.toScore) &&
+		r.action == other.action &&
+		r.currency == other.currency &&
+		r.eventType == other.eventType &&
+		equalScore(r.ratingDir, other.ratingDir) &&
+		equalScore(r.targetDir, other.targetDir) &&
+		r.time.Equal(other.time)
+}
+
+func equalTarget(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalScore(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// materialize builds the API representation of a stored recommendation, callers hold the lock
+func (s *MemoryStore) materialize(r *memoryRecommendation) Recommendation {
+	rec := Recommendation{
+		ID:              r.id,
+		Company:         *s.companies[r.ticker],
+		TargetFrom:      r.targetFrom,
+		TargetTo:        r.targetTo,
+		RatingFrom:      r.ratingFrom,
+		RatingTo:        r.ratingTo,
+		RatingFromScore: r.fromScore,
+		RatingToScore:   r.toScore,
+		Action:          r.action,
+		EventType:       r.eventType,
+		RatingDirection: r.ratingDir,
+		TargetDirection: r.targetDir,
+		Currency:        r.currency,
+		Time:            r.time,
+		Source:          r.source,
+		CreatedAt:       r.createdAt,
+		UpdatedAt:       r.updatedAt,
+	}
+	if b, ok := s.brokerages[r.brokerageID]; ok {
+		brokerage := *b
+		rec.Brokerage = &brokerage
+	}
+	return rec
+}
+
+func (s *MemoryStore) ListRatingMappings(ctx context.Context) ([]RatingMapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mappings := make([]RatingMapping, 0, len(s.ratingScores))
+	for key, score := range s.ratingScores {
+		mappings = append(mappings, RatingMapping{RatingKey: key, Score: score, Label: RatingLabel(score)})
+	}
+	//Like ORDER BY score DESC, rating_key ASC
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].Score != mappings[j].Score {
+			return mappings[i].Score > mappings[j].Score
+		}
+		return mappings[i].RatingKey < mappings[j].RatingKey
+	})
+	return mappings, nil
+}
+
+func (s *MemoryStore) SetRatingMapping(ctx context.Context, rating string, score int) (int, error) {
+	key, err := ValidateRatingMapping(rating, score)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ratingScores[key] = score
+	return s.renormalize(key), nil
+}
+
+func (s *MemoryStore) ListUnmappedRatings(ctx context.Context) ([]UnmappedRating, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, r := range s.recommendations {
+		for _, rating := range []string{r.ratingFrom, r.ratingTo} {
+			key := RatingKey(rating)
+			if _, ok := s.ratingScores[key]; key == "" || ok {
+				continue
+			}
+			counts[rating]++
+		}
+	}
+
+	unmapped := make([]UnmappedRating, 0, len(counts))
+	for rating, count := range counts {
+		unmapped = append(unmapped, UnmappedRating{Rating: rating, Occurrences: count})
+	}
+	sort.Slice(unmapped, func(i, j int) bool {
+		if unmapped[i].Occurrences != unmapped[j].Occurrences {
+			return unmapped[i].Occurrences > unmapped[j].Occurrences
+		}
+		return unmapped[i].Rating < unmapped[j].Rating
+	})
+	return unmapped, nil
+}
+
+func (s *MemoryStore) RenormalizeRatings(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.renormalize(""), nil
+}
+
+// renormalize recomputes the rating scores of the recommendations using the
+// rating with the given key, or of all of them when key is empty; callers hold the write lock
+func (s *MemoryStore) renormalize(key string) int {
+	updated := 0
+	now := s.now()
+	for _, r := range s.recommendations {
+		if key != "" && RatingKey(r.ratingFrom) != key && RatingKey(r.ratingTo) != key {
+			continue
+		}
+		fromScore := normalizeRating(s.ratingScores, r.ratingFrom)
+		toScore := normalizeRating(s.ratingScores, r.ratingTo)
+		if equalScore(fromScore, r.fromScore) && equalScore(toScore, r.toScore) {
+			continue
+		}
+		r.fromScore, r.toScore, r.updatedAt = fromScore, toScore, now
+		updated++
+	}
+	return updated
+}
+
+// ListIngestRuns returns no runs, ingestion always writes to PostgreSQL
+func (s *MemoryStore) ListIngestRuns(ctx context.Context, limit, offset int) ([]IngestRun, int, error) {
+	return []IngestRun{}, 0, nil
+}
+
+// ListSchemaReports returns no reports, for the same reason
+func (s *MemoryStore) ListSchemaReports(ctx context.Context, filter SchemaReportFilter, limit, offset int) ([]SchemaReport, int, error) {
+	return []SchemaReport{}, 0, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_UpsertIsIdempotent(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	data := baseRecommendationData()
+
+	result, err := store.UpsertRecommendations(ctx, []RecommendationData{data, data}, SaveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 1, Unchanged: 1}, result)
+
+	result, err = store.UpsertRecommendations(ctx, []RecommendationData{data}, SaveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Unchanged: 1}, result)
+
+	//A stored row whose derived values differ is updated in place
+	store.byFingerprint[DefaultSourceName+"/"+data.Fingerprint()].targetFrom = nil
+
+	result, err = store.UpsertRecommendations(ctx, []RecommendationData{data}, SaveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Updated: 1}, result)
+
+	recommendations, total, err := store.ListRecommendations(ctx, RecommendationFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, recommendations, 1)
+	require.NotNil(t, recommendations[0].TargetFrom)
+	assert.Equal(t, 180.0, *recommendations[0].TargetFrom)
+}
+
+func TestMemoryStore_UpsertRenamesCompanies(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	data := baseRecommendationData()
+
+	renamed := data
+	renamed.Ticker = " aapl"
+	renamed.Company = "Apple"
+	renamed.Time = data.Time.Add(time.Hour)
+	unnamed := data
+	unnamed.Company = ""
+	unnamed.Time = data.Time.Add(2 * time.Hour)
+
+	_, err := store.UpsertRecommendations(ctx, []RecommendationData{data, renamed, unnamed}, SaveOptions{})
+	require.NoError(t, err)
+
+	companies, err := store.ListCompanies(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, companies, 1, "tickers are keyed like fingerprints")
+	assert.Equal(t, "AAPL", companies[0].Ticker)
+	assert.Equal(t, "Apple", companies[0].Name, "recommendations without a company name keep the stored one")
+}
+
+func TestMemoryStore_ListRecommendations(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var batch []RecommendationData
+	for i, ticker := range []string{"AAPL", "MSFT", "AAPL", "NVDA"} {
+		data := baseRecommendationData()
+		data.Ticker = ticker
+		data.Time = start.Add(time.Duration(i) * time.Hour)
+		batch = append(batch, data)
+	}
+	batch[3].Brokerage = "Morgan Stanley"
+
+	_, err := store.UpsertRecommendations(ctx, batch, SaveOptions{})
+	require.NoError(t, err)
+
+	recommendations, total, err := store.ListRecommendations(ctx, RecommendationFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+	require.Len(t, recommendations, 2)
+	assert.Equal(t, "NVDA", recommendations[0].Company.Ticker, "newest first")
+	assert.Equal(t, "AAPL", recommendations[1].Company.Ticker)
+
+	recommendations, total, err = store.ListRecommendations(ctx, RecommendationFilter{Ticker: "AAPL", Limit: 10, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, recommendations, 1)
+	assert.Equal(t, start, recommendations[0].Time)
+
+	brokerages, err := store.ListBrokerages(ctx)
+	require.NoError(t, err)
+	require.Len(t, brokerages, 2)
+	assert.Equal(t, "Goldman Sachs", brokerages[0].Name)
+
+	recommendations, total, err = store.ListRecommendations(ctx, RecommendationFilter{BrokerageID: brokerages[1].ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "Morgan Stanley", recommendations[0].Brokerage.Name)
+}
+
+func TestMemoryStore_NotFound(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	_, err := store.GetCompanyByTicker(ctx, "NOPE")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = store.GetBrokerage(ctx, "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = store.GetRecommendation(ctx, "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestMemoryStore_DeduplicatesPerSource(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	fromAPI := baseRecommendationData()
+	fromFile := fromAPI
+	fromFile.Source = "csv"
+
+	result, err := store.UpsertRecommendations(ctx, []RecommendationData{fromAPI, fromFile}, SaveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 2}, result)
+
+	recommendations, total, err := store.ListRecommendations(ctx, RecommendationFilter{Source: "csv", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, recommendations, 1)
+	assert.Equal(t, "csv", recommendations[0].Source)
+}
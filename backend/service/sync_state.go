@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"stock-investment-backend/connection"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// SyncState is the checkpoint persisted between incremental sync runs.
+// NextPage holds the token of the next page still to be fetched by an
+// unfinished run, LastTime the newest recommendation time committed by the
+// last completed run and RunMaxTime the newest time seen by the current run.
+type SyncState struct {
+	Name       string
+	NextPage   string
+	LastTime   *time.Time
+	RunMaxTime *time.Time
+	UpdatedAt  time.Time
+}
+
+// InProgress reports whether a previous run stopped before reaching the end.
+func (s *SyncState) InProgress() bool {
+	return s.NextPage != ""
+}
+
+// Observe records the time of a processed recommendation in the current run.
+func (s *SyncState) Observe(t time.Time) {
+	if s.RunMaxTime == nil || t.After(*s.RunMaxTime) {
+		observed := t
+		s.RunMaxTime = &observed
+	}
+}
+
+// Complete promotes the newest time seen by the run to the committed
+// watermark and clears the resume token.
+func (s *SyncState) Complete() {
+	if s.RunMaxTime != nil && (s.LastTime == nil || s.RunMaxTime.After(*s.LastTime)) {
+		s.LastTime = s.RunMaxTime
+	}
+	s.RunMaxTime = nil
+	s.NextPage = ""
+}
+
+// LoadSyncState returns the checkpoint stored under name, or an empty state if none exists yet.
+func LoadSyncState(conn connection.DBConnection, ctx context.Context, name string) (*SyncState, error) {
+	state := &SyncState{Name: name}
+	var nextPage *string
+
+	err := conn.QueryRow(ctx,
+		`SELECT next_page, last_time, run_max_time, updated_at
+		FROM sync_state
+		WHERE name = $1`,
+		name).Scan(&nextPage, &state.LastTime, &state.RunMaxTime, &state.UpdatedAt)
+
+	if err == pgx.ErrNoRows {
+		return state, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	if nextPage != nil {
+		state.NextPage = *nextPage
+	}
+	return state, nil
+}
+
+// loadSyncState reads the checkpoint of name on a connection of its own
+var loadSyncState = func(ctx context.Context, name string) (*SyncState, error) {
+	var state *SyncState
+	err := withConnection(func(conn connection.DBConnection) (err error) {
+		state, err = LoadSyncState(conn, ctx, name)
+		return err
+	})
+	return state, err
+}
+
+// saveSyncState checkpoints state on a connection of its own
+var saveSyncState = func(ctx context.Context, state *SyncState) error {
+	return withConnection(func(conn connection.DBConnection) error {
+		return SaveSyncState(conn, ctx, state)
+	})
+}
+
+// SaveSyncState upserts the checkpoint for state.Name.
+func SaveSyncState(conn connection.DBConnection, ctx context.Context, state *SyncState) error {
+	var nextPage *string
+	if state.NextPage != "" {
+		nextPage = &state.NextPage
+	}
+
+	_, err := conn.Exec(ctx,
+		`INSERT INTO sync_state (name, next_page, last_time, run_max_time)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET
+		next_page = EXCLUDED.next_page,
+		last_time = EXCLUDED.last_time,
+		run_max_time = EXCLUDED.run_max_time,
+		updated_at = now()`,
+		state.Name, nextPage, state.LastTime, state.RunMaxTime)
+	if err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
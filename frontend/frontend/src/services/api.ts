@@ -22,6 +22,8 @@ export const apiService = {
   async getRecommendations(params?: {
     limit?: number;
     offset?: number;
+    cursor?: string;
+    count?: boolean;
     ticker?: string;
     brokerage_id?: string;
   }): Promise<APIResponse<Recommendation[]>> {
@@ -1,7 +1,8 @@
 import { defineStore } from "pinia";
 import { ref, computed } from "vue";
+import axios from "axios";
 import { apiService } from "@/services/api";
-import type { Company, Brokerage, Recommendation } from "@/types";
+import type { Company, Brokerage, Recommendation, Problem } from "@/types";
 
 export const useMainStore = defineStore("main", () => {
   //State
@@ -68,13 +69,8 @@ export const useMainStore = defineStore("main", () => {
       recommendations.value = [];
 
       const limit = 100;
-      let offset = 0;
-      let hasMore = true;
 
-      const firstResponse = await apiService.getRecommendations({
-        limit,
-        offset,
-      });
+      const firstResponse = await apiService.getRecommendations({ limit });
 
       if (!firstResponse.success) {
         error.value = firstResponse.error || "Failed to fetch recommendations";
@@ -84,25 +80,31 @@ export const useMainStore = defineStore("main", () => {
       totalRecommendations.value =
         firstResponse.meta?.total || firstResponse.data.length;
       recommendations.value = [...firstResponse.data];
-      offset += limit;
+      // Follow the cursors, which stay stable while new data is ingested,
+      // without counting the table again on every page
+      let cursor = firstResponse.meta?.next_cursor;
 
       console.log(
         `✅ Loaded ${recommendations.value.length}/${totalRecommendations.value} recommendations`
       );
 
-      while (hasMore && offset < totalRecommendations.value) {
-        const response = await apiService.getRecommendations({ limit, offset });
+      while (cursor) {
+        const response = await apiService.getRecommendations({
+          limit,
+          cursor,
+          count: false,
+        });
 
         if (response.success) {
           recommendations.value = [...recommendations.value, ...response.data];
-          offset += limit;
+          cursor = response.meta?.next_cursor;
           console.log(
             `📈 Progress: ${recommendations.value.length}/${totalRecommendations.value}`
           );
 
           await new Promise((resolve) => setTimeout(resolve, 100));
         } else {
-          hasMore = false;
+          cursor = undefined;
           error.value = response.error || "Failed to fetch recommendations";
         }
       }
@@ -110,7 +112,13 @@ export const useMainStore = defineStore("main", () => {
       dataFetched.value = true;
       console.log("🎉 All data fetched successfully!");
     } catch (err) {
-      error.value = "Network error: " + err;
+      // Failed requests answer with a problem, quote its request id when reporting it
+      const problem = axios.isAxiosError(err)
+        ? (err.response?.data as Problem | undefined)
+        : undefined;
+      error.value = problem?.detail
+        ? `${problem.title}: ${problem.detail} (request ${problem.request_id})`
+        : "Network error: " + err;
     } finally {
       loading.value = false;
     }
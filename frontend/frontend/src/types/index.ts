@@ -27,13 +27,25 @@ export interface Recommendation {
   updated_at: string;
 }
 
+// RFC 7807 body of failed API requests
+export interface Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  request_id?: string;
+}
+
 export interface APIResponse<T> {
   success: boolean;
   data: T;
   error?: string;
   meta?: {
-    total: number;
+    // Left out when the request passed count=false
+    total?: number;
     limit: number;
     offset: number;
+    next_cursor?: string;
+    prev_cursor?: string;
   };
 }